@@ -6,6 +6,7 @@ import (
 	"kubconfig-cli/config"
 	"os"
 	"path/filepath"
+	"strings"
 	"time"
 
 	"github.com/aws/aws-sdk-go/aws"
@@ -14,97 +15,590 @@ import (
 )
 
 func init() {
-	ActivateCmd.Flags().DurationP("session", "s", 8*time.Hour, "Session duration (e.g., 2h, 30m, 1h30m)")
-	ActivateCmd.MarkFlagRequired("session")
+	ActivateCmd.Flags().DurationP("session", "s", 0, "Session duration (e.g., 2h, 30m, 1h30m; default from policy)")
+	ActivateCmd.Flags().String("role", "", "ClusterRole to grant (default from policy, otherwise cluster-admin)")
+	ActivateCmd.Flags().StringP("namespace", "n", "", "Only grant the role within this namespace")
+	ActivateCmd.Flags().String("context", "", "Context of the kubeconfig to activate (default: its current context)")
+	ActivateCmd.Flags().String("reason", "", "Reason for the activation, e.g. \"INC-1234 payment pods crashlooping\"")
+	ActivateCmd.Flags().String("ticket", "", "Ticket reference (default: first ticket ID found in the reason)")
+	ActivateCmd.Flags().String("request", "", "Resume waiting for an earlier approval request")
+	ActivateCmd.Flags().Duration("wait", 30*time.Minute, "How long to wait for approval")
+	ActivateCmd.Flags().String("auth", config.AuthAuto, "Authentication mode: auto, serviceaccount, impersonate, eks or exec")
+	ActivateCmd.Flags().String("as-user", "", "User to impersonate with --auth impersonate: kubconfig:<user> or kubconfig:<user>:<suffix> (default kubconfig:<user>)")
+	ActivateCmd.Flags().StringSlice("as-group", nil, "kubconfig:<role> groups to impersonate with --auth impersonate (default kubconfig:<role>)")
+	ActivateCmd.Flags().String("aws-role-arn", "", "IAM role to assume for EKS clusters (default from the kubeconfig)")
+	ActivateCmd.Flags().StringSlice("audience", nil, "Additional audiences of the session token, besides the API server")
+	ActivateCmd.Flags().String("shell-eval", "", "Activate a session private to the calling shell and print shell code (sh, bash, zsh or fish) setting KUBECONFIG")
+	ActivateCmd.Flags().Lookup("shell-eval").NoOptDefVal = "sh"
+	ActivateCmd.Flags().StringToString("tag", nil, "Activate every kubeconfig with these tags (e.g., --tag env=prod)")
+	ActivateCmd.Flags().String("region", "", "Activate every kubeconfig tagged with this region (same as --tag region=...)")
+	ActivateCmd.Flags().Int("parallel", 4, "Number of kubeconfigs of a group activated at a time")
+	ActivateCmd.RegisterFlagCompletionFunc("role", completeRoles)
+	ActivateCmd.RegisterFlagCompletionFunc("context", completeContexts)
+	ActivateCmd.RegisterFlagCompletionFunc("tag", completeTags)
+	ActivateCmd.RegisterFlagCompletionFunc("region", completeRegions)
 	config.StartCleanupRoutine()
 }
 
 var ActivateCmd = &cobra.Command{
-	Use:   "activate [KUBECONFIG_NAME]",
+	Use:   "activate [KUBECONFIG_NAME...]",
 	Short: "Activate a kubeconfig from the S3 bucket",
-	Args:  cobra.ExactArgs(1),
+	Long: `Activate a kubeconfig from the S3 bucket or an alias of one. Without a
+name, a fuzzy finder in the terminal lists the bucket's kubeconfigs with their
+tags, when they were last used and whether a session is active; the session
+duration is asked for unless --session is given. "-" activates the previously
+used kubeconfig again with its last duration, role and namespace.
+
+Several names, --tag or --region activate a group of kubeconfigs at once,
+--parallel at a time, into one kubeconfig with a context per kubeconfig.
+Clusters that fail are reported and left out; 'deactivate' revokes the
+sessions on all of them.`,
+	Example: `  kubconfig activate prod-eu-1.cfg prod-eu-2.cfg --session 1h
+  kubconfig activate --tag env=prod --region eu --reason "INC-1234 regional outage"`,
+	Args:              cobra.ArbitraryArgs,
+	ValidArgsFunction: completeConfigList,
 	Run: func(cmd *cobra.Command, args []string) {
-		kubeconfigName := args[0]
-		sessionDuration, err := cmd.Flags().GetDuration("session")
-		if err != nil || sessionDuration <= 0 {
-			fmt.Println("Error: Valid session duration is required (e.g., --session 2h)")
-			return
+		shell, _ := cmd.Flags().GetString("shell-eval")
+		evalOut := os.Stdout
+		if shell != "" {
+			// Only shell code may reach stdout, which the shell evaluates
+			os.Stdout = os.Stderr
+			defer func() { os.Stdout = evalOut }()
 		}
 
-		// Validate session duration
-		if sessionDuration > 24*time.Hour {
-			fmt.Println("Error: Maximum session duration is 24 hours")
+		// Load config
+		cfg, err := config.LoadConfig()
+		if err != nil {
+			fmt.Printf("Error loading configuration: %v\n", err)
 			return
 		}
-		if sessionDuration < 10*time.Minute {
-			fmt.Printf("Warning: Minimum session duration is 10 minutes, adjusting...\n")
-			sessionDuration = 10 * time.Minute
+
+		tags, _ := cmd.Flags().GetStringToString("tag")
+		if region, _ := cmd.Flags().GetString("region"); region != "" {
+			if tags == nil {
+				tags = make(map[string]string)
+			}
+			tags["region"] = region
 		}
 
-		// Load config
-		cfg, err := config.LoadConfig()
+		// Several kubeconfigs or tags select a group
+		var group []string
+		if len(args) > 1 || len(tags) > 0 {
+			if group, err = groupMembers(cfg, args, tags); err != nil {
+				fmt.Printf("Error: %v\n", err)
+				return
+			}
+		}
+
+		// Without a name, pick one from the catalog
+		kubeconfigName := ""
+		if len(group) > 0 {
+			kubeconfigName = strings.Join(group, ", ")
+		} else if len(args) > 0 {
+			kubeconfigName = args[0]
+		} else if kubeconfigName, err = pickKubeconfig(cfg); err != nil {
+			fmt.Printf("Error: %v\n", err)
+			return
+		}
+
+		opts, err := activateOptionsFromFlags(cmd, kubeconfigName)
 		if err != nil {
-			fmt.Printf("Error loading configuration: %v\n", err)
+			fmt.Printf("Error: %v\n", err)
 			return
 		}
+		opts.Group = group
+		opts.Parallel, _ = cmd.Flags().GetInt("parallel")
+		if len(args) == 0 && len(group) == 0 && !cmd.Flags().Changed("session") {
+			opts.Duration = promptDuration()
+		}
+		if opts.Config == "-" {
+			if err := usePreviousActivation(cmd, &opts); err != nil {
+				fmt.Printf("Error: %v\n", err)
+				return
+			}
+		}
 
-		// Validate kubeconfig name
-		if err := config.ValidateKubeconfigName(kubeconfigName); err != nil {
-			fmt.Printf("Invalid kubeconfig name: %v\n", err)
+		if shell != "" {
+			activateForShell(evalOut, cfg, opts, shell)
 			return
 		}
 
-		// Download from S3 and set as current context
-		originalConfig, err := downloadFromS3(cfg, kubeconfigName)
+		session, sessionKubeconfig, err := activateSessionOrGroup(cfg, opts)
 		if err != nil {
-			fmt.Printf("Error downloading kubeconfig: %v\n", err)
+			fmt.Printf("Error activating %s: %v\n", opts.Config, err)
 			return
 		}
 
-		// Create temporary kubeconfig with original config
-		tempKubeconfig := filepath.Join(config.CacheDir, fmt.Sprintf("%s.tmp", kubeconfigName))
-		if err := os.WriteFile(tempKubeconfig, originalConfig, 0600); err != nil {
-			fmt.Printf("Error creating temporary kubeconfig: %v\n", err)
+		// Earlier sessions stay active and can be switched back to
+		previous := currentSwitchableSession()
+
+		// Save the modified config
+		if err := saveCurrentKubeconfig(session, sessionKubeconfig); err != nil {
+			fmt.Printf("Error saving kubeconfig: %v\n", err)
 			return
 		}
-		defer os.Remove(tempKubeconfig)
 
-		// Set KUBECONFIG to use original config for creating resources
-		originalKubeconfig := os.Getenv("KUBECONFIG")
-		os.Setenv("KUBECONFIG", tempKubeconfig)
-		defer os.Setenv("KUBECONFIG", originalKubeconfig)
+		// Record the session so it can be inspected and revoked later
+		if err := recordSession(session); err != nil {
+			fmt.Printf("Warning: Could not record session: %v\n", err)
+		}
+
+		fmt.Printf("Successfully activated '%s' (session expires at %s)\n",
+			session.Config,
+			session.ExpiresAt.Format(time.RFC3339))
+		if previous != nil {
+			fmt.Printf("Session %s (%s) is still active; switch back with 'kubconfig use %s'\n",
+				previous.ID, previous.Config, previous.ID)
+		}
+	},
+}
+
+// activateForShell activates a session private to the calling shell and
+// writes the code that points the shell at it to out
+func activateForShell(out io.Writer, cfg config.Config, opts activateOptions, shell string) {
+	switch shell {
+	case "sh", "bash", "zsh", "fish":
+	default:
+		fmt.Fprintf(os.Stderr, "Error: unsupported shell %q (use sh, bash, zsh or fish)\n", shell)
+		os.Exit(1)
+	}
+
+	session, err := startPrivateSession(cfg, opts)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error activating %s: %v\n", opts.Config, err)
+		os.Exit(1)
+	}
+
+	fmt.Fprint(out, shellEnvCode(shell, []string{"KUBECONFIG", config.SessionEnv}, map[string]string{
+		"KUBECONFIG":      session.Kubeconfig,
+		config.SessionEnv: session.ID,
+	}))
+	fmt.Fprintf(os.Stderr, "Successfully activated '%s' in this shell (session %s expires at %s)\n",
+		session.Config, session.ID, session.ExpiresAt.Format(time.RFC3339))
+}
+
+// activateOptions describes a requested activation
+type activateOptions struct {
+	Config     string
+	Duration   time.Duration
+	Role       string
+	RoleSet    bool
+	Namespace  string
+	Context    string
+	Reason     string
+	Ticket     string
+	RequestID  string
+	Wait       time.Duration
+	AuthMode   string
+	AsUser     string
+	AsGroups   []string
+	AsGroupSet bool
+	AWSRoleARN string
+	Audiences  []string
+	// Issue generates a standalone kubeconfig for a dedicated ServiceAccount
+	Issue bool
+	// Group lists the kubeconfigs activated together, Parallel at a time
+	Group    []string
+	Parallel int
+}
+
+// activateOptionsFromFlags reads the activation flags of a command
+func activateOptionsFromFlags(cmd *cobra.Command, kubeconfigName string) (activateOptions, error) {
+	opts := activateOptions{Config: kubeconfigName}
+	var err error
+	opts.Duration, err = cmd.Flags().GetDuration("session")
+	if err != nil || opts.Duration < 0 {
+		return opts, fmt.Errorf("valid session duration is required (e.g., --session 2h)")
+	}
+	opts.Role, _ = cmd.Flags().GetString("role")
+	opts.RoleSet = cmd.Flags().Changed("role")
+	opts.Namespace, _ = cmd.Flags().GetString("namespace")
+	opts.Context, _ = cmd.Flags().GetString("context")
+	opts.Reason, _ = cmd.Flags().GetString("reason")
+	opts.Ticket, _ = cmd.Flags().GetString("ticket")
+	opts.RequestID, _ = cmd.Flags().GetString("request")
+	opts.Wait, _ = cmd.Flags().GetDuration("wait")
+	opts.AuthMode, _ = cmd.Flags().GetString("auth")
+	opts.AsUser, _ = cmd.Flags().GetString("as-user")
+	opts.AsGroups, _ = cmd.Flags().GetStringSlice("as-group")
+	opts.AsGroupSet = cmd.Flags().Changed("as-group")
+	opts.AWSRoleARN, _ = cmd.Flags().GetString("aws-role-arn")
+	opts.Audiences, _ = cmd.Flags().GetStringSlice("audience")
+	return opts, nil
+}
+
+// errPolicyDenied marks activations refused by the bucket policy
+type errPolicyDenied struct {
+	decision *config.Decision
+}
+
+func (e *errPolicyDenied) Error() string {
+	return fmt.Sprintf("denied by policy rule %q: %s", e.decision.Rule, strings.Join(e.decision.Denials, "; "))
+}
+
+// activateSession checks the policy, creates temporary credentials for a
+// kubeconfig and returns the session with its kubeconfig. Every attempt is
+// written to the audit trail.
+func activateSession(cfg config.Config, opts activateOptions) (session *config.Session, sessionKubeconfig []byte, err error) {
+	session = &config.Session{
+		ID:            config.NewSessionID(),
+		Config:        opts.Config,
+		Role:          opts.Role,
+		RoleNamespace: opts.Namespace,
+		Reason:        opts.Reason,
+		Ticket:        opts.Ticket,
+		Issued:        opts.Issue,
+		CreatedAt:     time.Now(),
+	}
+	defer func() {
+		// Do not leave behind access created before the activation failed,
+		// e.g. because it was interrupted
+		if err != nil && (session.ServiceAccount != "" || session.AuthMode == config.AuthImpersonate) {
+			if revokeErr := config.RevokeSession(session); revokeErr != nil {
+				fmt.Printf("Warning: Could not remove access created for session %s: %v\n", session.ID, revokeErr)
+			}
+		}
+
+		event := config.NewAuditEvent(config.AuditActivate, session)
+		if opts.Issue {
+			event.Details = "issued standalone kubeconfig"
+		}
+		if err != nil {
+			event.Result = config.ResultFailure
+			event.Error = err.Error()
+			if _, denied := err.(*errPolicyDenied); denied {
+				event.Result = config.ResultDenied
+			}
+		}
+		recordAudit(event)
+
+		if err == nil {
+			notifySession(cfg, config.AuditActivate, session)
+		}
+	}()
+
+	authMode := opts.AuthMode
+	switch authMode {
+	case config.AuthAuto, config.AuthServiceAccount, config.AuthImpersonate, config.AuthEKS, config.AuthExec:
+	default:
+		return session, nil, fmt.Errorf("unknown auth mode %q (use %s, %s, %s, %s or %s)", authMode,
+			config.AuthAuto, config.AuthServiceAccount, config.AuthImpersonate, config.AuthEKS, config.AuthExec)
+	}
+
+	// Aliases stand for the kubeconfig they name
+	if opts.Config, err = config.ResolveConfigName(cfg, opts.Config); err != nil {
+		return session, nil, err
+	}
+	session.Config = opts.Config
+
+	// Validate kubeconfig name
+	if err := config.ValidateKubeconfigName(opts.Config); err != nil {
+		return session, nil, fmt.Errorf("invalid kubeconfig name: %v", err)
+	}
+
+	session.User, err = config.CurrentUser()
+	if err != nil {
+		return session, nil, fmt.Errorf("error getting current user: %v", err)
+	}
+
+	// Check the request against the bucket policy
+	accessRequest := config.AccessRequest{
+		Config:    opts.Config,
+		User:      session.User,
+		Role:      opts.Role,
+		Namespace: opts.Namespace,
+		Duration:  opts.Duration,
+		Reason:    opts.Reason,
+	}
+	decision, err := evaluatePolicy(cfg, accessRequest)
+	if err != nil {
+		return session, nil, fmt.Errorf("error evaluating policy: %v", err)
+	}
+
+	// Ask for a reason when none was given
+	reason := opts.Reason
+	if reason == "" && isInteractive() {
+		requirement := "optional"
+		if decision.RequireReason {
+			requirement = "required"
+		}
+		reason = promptLine(fmt.Sprintf("Reason for access (%s): ", requirement))
+
+		if reason != "" && decision.RequireReason {
+			accessRequest.Reason = reason
+			if decision, err = evaluatePolicy(cfg, accessRequest); err != nil {
+				return session, nil, fmt.Errorf("error evaluating policy: %v", err)
+			}
+		}
+	}
+	session.Reason = reason
+	if session.Ticket == "" {
+		session.Ticket = config.ExtractTicket(reason)
+	}
+
+	printDecisionNotes(decision)
+	if !decision.Allowed {
+		printDecision(decision)
+		return session, nil, &errPolicyDenied{decision}
+	}
+	sessionDuration := decision.Duration
+	role := decision.Role
+	namespace := opts.Namespace
+	session.Role = role
+	session.ExpiresAt = session.CreatedAt.Add(sessionDuration)
+
+	// Privileged activations need a second user's approval
+	var approvalIdentity *config.Identity
+	if decision.RequireApproval {
+		if opts.RequestID != "" {
+			session.ID = opts.RequestID
+		}
+
+		approvalIdentity, err = waitForApproval(cfg, &config.ApprovalRequest{
+			ID:        session.ID,
+			Requester: session.User,
+			Config:    opts.Config,
+			Role:      role,
+			Namespace: namespace,
+			Duration:  sessionDuration.String(),
+			Reason:    session.Reason,
+			Ticket:    session.Ticket,
+		}, opts.RequestID != "", opts.Wait)
+		if err != nil {
+			return session, nil, err
+		}
+	}
+
+	// Download from S3 and set as current context
+	originalConfig, err := downloadFromS3(cfg, opts.Config)
+	if err != nil {
+		return session, nil, fmt.Errorf("error downloading kubeconfig: %v", err)
+	}
 
+	// Keep only the chosen context, so neither kubectl nor the session
+	// kubeconfig see the credentials of other contexts
+	originalConfig, session.Context, err = config.MinifyKubeconfig(originalConfig, opts.Context)
+	if err != nil {
+		return session, nil, fmt.Errorf("error selecting context: %v", err)
+	}
+	session.Cluster, session.Server, _ = config.KubeconfigCluster(originalConfig)
+
+	// Create temporary kubeconfig with original config
+	tempKubeconfig := filepath.Join(config.CacheDir, fmt.Sprintf("%s.tmp", opts.Config))
+	if err := os.WriteFile(tempKubeconfig, originalConfig, 0600); err != nil {
+		return session, nil, fmt.Errorf("error creating temporary kubeconfig: %v", err)
+	}
+	defer os.Remove(tempKubeconfig)
+
+	// Set KUBECONFIG to use original config for creating resources
+	originalKubeconfig := os.Getenv("KUBECONFIG")
+	os.Setenv("KUBECONFIG", tempKubeconfig)
+	defer os.Setenv("KUBECONFIG", originalKubeconfig)
+
+	// EKS clusters authenticate through IAM and other exec plugins are
+	// wrapped, so no ServiceAccount is needed for either
+	eksConfig, err := config.DetectEKS(originalConfig)
+	if err != nil {
+		return session, nil, fmt.Errorf("error reading EKS configuration: %v", err)
+	}
+	usesExec, err := config.UsesExecPlugin(originalConfig)
+	if err != nil {
+		return session, nil, fmt.Errorf("error reading kubeconfig: %v", err)
+	}
+	if opts.Issue {
+		// Only ServiceAccount tokens work without the master credentials
+		if authMode != config.AuthAuto && authMode != config.AuthServiceAccount {
+			return session, nil, fmt.Errorf("issued kubeconfigs require %s authentication", config.AuthServiceAccount)
+		}
+		authMode = config.AuthServiceAccount
+	}
+	if authMode == config.AuthAuto {
+		switch {
+		case decision.Restricted():
+			// Only ServiceAccount sessions are bound to the granted role
+			authMode = config.AuthServiceAccount
+		case eksConfig != nil:
+			authMode = config.AuthEKS
+		case usesExec:
+			authMode = config.AuthExec
+		default:
+			authMode = config.AuthServiceAccount
+		}
+	}
+	switch {
+	case (authMode == config.AuthEKS || authMode == config.AuthExec) && decision.Restricted():
+		return session, nil, fmt.Errorf("policy rule %q restricts roles or namespaces, which %s authentication cannot enforce; use --auth %s",
+			decision.Rule, authMode, config.AuthServiceAccount)
+	case authMode == config.AuthImpersonate && (len(decision.Namespaces) > 0 || namespace != ""):
+		return session, nil, fmt.Errorf("%s authentication cannot limit access to a namespace; use --auth %s",
+			authMode, config.AuthServiceAccount)
+	}
+	session.AuthMode = authMode
+
+	var expiresAt time.Time
+	switch authMode {
+	case config.AuthServiceAccount:
 		// Create temporary access
-		saConfig, err := config.CreateTemporaryAccess(sessionDuration)
+		saConfig, err := config.CreateTemporaryAccess(config.AccessOptions{
+			SessionID: session.ID,
+			Duration:  sessionDuration,
+			Role:      role,
+			Namespace: namespace,
+			Reason:    session.Reason,
+			Ticket:    session.Ticket,
+			Audiences: opts.Audiences,
+		})
 		if err != nil {
-			fmt.Printf("Error creating temporary access: %v\n", err)
-			return
+			return session, nil, fmt.Errorf("error creating temporary access: %v", err)
 		}
+		session.ServiceAccount = saConfig.Name
+		session.Namespace = saConfig.Namespace
 
 		// Get token with TTL
 		token, err := config.GetTemporaryToken(saConfig)
 		if err != nil {
-			fmt.Printf("Error getting token: %v\n", err)
-			return
+			return session, nil, fmt.Errorf("error getting token: %v", err)
+		}
+
+		if opts.Issue {
+			// Keep only this cluster's CA and the token
+			caCert, err := config.ClusterCA()
+			if err != nil {
+				return session, nil, err
+			}
+			if caCert == "" {
+				return session, nil, fmt.Errorf("cluster %s has no embedded CA certificate", saConfig.ClusterName)
+			}
+			sessionKubeconfig = []byte(config.GenerateKubeconfig(saConfig, token, caCert))
+		} else {
+			// Modify the original kubeconfig with the temporary token
+			sessionKubeconfig, err = config.ModifyKubeconfigWithToken(originalConfig, token)
+			if err != nil {
+				return session, nil, fmt.Errorf("error modifying kubeconfig: %v", err)
+			}
 		}
+		expiresAt = saConfig.ExpiresAt
 
-		// Modify the original kubeconfig with the temporary token
-		sessionKubeconfig, err := config.ModifyKubeconfigWithToken(originalConfig, token)
+	case config.AuthImpersonate:
+		// Map the granted role to a group admins have bound once
+		asGroups := []string{"kubconfig:" + role}
+		if opts.AsGroupSet {
+			asGroups = opts.AsGroups
+		}
+		if err := config.ValidateImpersonation(session.User, opts.AsUser, asGroups, role, decision.Roles); err != nil {
+			return session, nil, err
+		}
+
+		impConfig, err := config.CreateImpersonationSession(session.ID, sessionDuration, opts.AsUser, asGroups)
 		if err != nil {
-			fmt.Printf("Error modifying kubeconfig: %v\n", err)
-			return
+			return session, nil, fmt.Errorf("error creating impersonation session: %v", err)
 		}
 
-		// Save the modified config
-		if err := os.WriteFile(config.KubeConfigFile, sessionKubeconfig, 0600); err != nil {
-			fmt.Printf("Error saving kubeconfig: %v\n", err)
-			return
+		// Keep the master credentials in the proxy, out of the session kubeconfig
+		proxy, err := config.NewImpersonationProxy(originalConfig, impConfig)
+		if err != nil {
+			return session, nil, fmt.Errorf("error preparing impersonation proxy: %v", err)
 		}
+		address, err := startImpersonationProxy(proxy)
+		if err != nil {
+			return session, nil, err
+		}
+		sessionKubeconfig, err = config.ModifyKubeconfigForImpersonation(originalConfig, impConfig, address)
+		if err != nil {
+			return session, nil, fmt.Errorf("error modifying kubeconfig: %v", err)
+		}
+		expiresAt = impConfig.ExpiresAt
+		fmt.Printf("Impersonating %s (groups: %s)\n", impConfig.User, strings.Join(impConfig.Groups, ", "))
 
-		fmt.Printf("Successfully activated '%s' (session expires at %s)\n",
-			kubeconfigName,
-			saConfig.ExpiresAt.Format(time.RFC3339))
-	},
+	case config.AuthEKS:
+		if eksConfig == nil {
+			return session, nil, fmt.Errorf("kubeconfig does not use EKS authentication")
+		}
+		if opts.AWSRoleARN != "" {
+			eksConfig.RoleARN = opts.AWSRoleARN
+		}
+		expiresAt = time.Now().Add(sessionDuration)
+		session.Role, session.RoleNamespace = "", ""
+
+		// Make sure a token can be generated before handing out the config
+		if _, _, err := config.GenerateEKSToken(eksConfig, expiresAt); err != nil {
+			return session, nil, fmt.Errorf("error generating EKS token: %v", err)
+		}
+
+		sessionKubeconfig, err = config.ModifyKubeconfigForEKS(originalConfig, eksConfig, expiresAt)
+		if err != nil {
+			return session, nil, fmt.Errorf("error modifying kubeconfig: %v", err)
+		}
+		fmt.Printf("Using IAM authentication for EKS cluster %s\n", eksConfig.ClusterName)
+
+	case config.AuthExec:
+		if !usesExec {
+			return session, nil, fmt.Errorf("kubeconfig does not use an exec credential plugin")
+		}
+		expiresAt = time.Now().Add(sessionDuration)
+		session.Role, session.RoleNamespace = "", ""
+
+		sessionKubeconfig, err = config.ModifyKubeconfigForExec(originalConfig, expiresAt)
+		if err != nil {
+			return session, nil, fmt.Errorf("error modifying kubeconfig: %v", err)
+		}
+		fmt.Println("Wrapping exec credential plugin with session expiry")
+	}
+
+	if authMode == config.AuthEKS || authMode == config.AuthExec {
+		if opts.RoleSet || namespace != "" {
+			fmt.Printf("Warning: --role and --namespace are not applied with %s authentication\n", authMode)
+		}
+	}
+	if authMode != config.AuthServiceAccount && len(opts.Audiences) > 0 {
+		fmt.Printf("Warning: --audience is only applied with %s authentication\n", config.AuthServiceAccount)
+	}
+
+	session.ExpiresAt = expiresAt
+
+	// An approval is good for one activation
+	if approvalIdentity != nil {
+		if err := config.ConsumeApprovalRequest(cfg, approvalIdentity, session.ID); err != nil {
+			return session, nil, fmt.Errorf("error using approval: %v", err)
+		}
+	}
+
+	// Remember the activation for 'recent' and 'activate -'
+	if !opts.Issue {
+		if err := config.AddHistory(config.HistoryEntry{
+			Time:      session.CreatedAt,
+			Config:    session.Config,
+			Role:      session.Role,
+			Namespace: session.RoleNamespace,
+			Context:   session.Context,
+			Duration:  sessionDuration.String(),
+			AuthMode:  authMode,
+		}); err != nil {
+			fmt.Printf("Warning: Could not record history: %v\n", err)
+		}
+	}
+	return session, sessionKubeconfig, nil
+}
+
+// saveCurrentKubeconfig keeps a session's kubeconfig in the session
+// directory and copies it to the default kubeconfig
+func saveCurrentKubeconfig(session *config.Session, kubeconfig []byte) error {
+	session.Kubeconfig = config.GetSessionFile(session.ID)
+	if err := os.MkdirAll(config.SessionDir, 0700); err != nil {
+		return err
+	}
+	if err := os.WriteFile(session.Kubeconfig, kubeconfig, 0600); err != nil {
+		return err
+	}
+	return os.WriteFile(config.KubeConfigFile, kubeconfig, 0600)
+}
+
+// recordSession adds a session to the registry as the current session
+func recordSession(session *config.Session) error {
+	return config.UpdateSessionRegistry(func(registry *config.SessionRegistry) {
+		registry.Add(session)
+		registry.Current = session.ID
+	})
 }
 
 func downloadFromS3(cfg config.Config, kubeconfigName string) ([]byte, error) {
@@ -0,0 +1,168 @@
+package cmd
+
+import (
+	"fmt"
+	"kubconfig-cli/config"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+)
+
+var AliasCmd = &cobra.Command{
+	Use:   "alias",
+	Short: "Manage short names for kubeconfigs",
+	Long: `Aliases are short names accepted wherever a kubeconfig name is, e.g.
+'kubconfig activate prod'. Personal aliases are stored in
+~/.kube/kubconfig-aliases.yaml; with --shared they are stored in aliases.yaml
+in the bucket for everyone. Personal aliases take precedence.`,
+}
+
+var aliasSetCmd = &cobra.Command{
+	Use:   "set NAME=KUBECONFIG_NAME",
+	Short: "Define an alias for a kubeconfig",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		name, target, ok := strings.Cut(args[0], "=")
+		if !ok {
+			fmt.Println("Error: expected NAME=KUBECONFIG_NAME, e.g. prod=prod-us-east-1-payments.cfg")
+			return
+		}
+		if err := config.ValidateAliasName(name); err != nil {
+			fmt.Printf("Error: %v\n", err)
+			return
+		}
+		if err := config.ValidateKubeconfigName(target); err != nil {
+			fmt.Printf("Error: invalid kubeconfig name: %v\n", err)
+			return
+		}
+
+		shared, _ := cmd.Flags().GetBool("shared")
+		if err := updateAliases(shared, func(aliases config.Aliases) { aliases[name] = target }); err != nil {
+			fmt.Printf("Error saving alias: %v\n", err)
+			return
+		}
+		fmt.Printf("%s now stands for %s\n", name, target)
+	},
+}
+
+var aliasRmCmd = &cobra.Command{
+	Use:               "rm NAME",
+	Short:             "Remove an alias",
+	Args:              cobra.ExactArgs(1),
+	ValidArgsFunction: completeAliasNames,
+	Run: func(cmd *cobra.Command, args []string) {
+		name := args[0]
+		shared, _ := cmd.Flags().GetBool("shared")
+
+		found := false
+		err := updateAliases(shared, func(aliases config.Aliases) {
+			_, found = aliases[name]
+			delete(aliases, name)
+		})
+		if err != nil {
+			fmt.Printf("Error removing alias: %v\n", err)
+			return
+		}
+		if !found {
+			fmt.Printf("Error: alias %s not found\n", name)
+			return
+		}
+		fmt.Printf("Removed alias %s\n", name)
+	},
+}
+
+var aliasListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List personal and shared aliases",
+	Args:  cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		personal, err := config.LoadAliases()
+		if err != nil {
+			fmt.Printf("Error reading aliases: %v\n", err)
+			return
+		}
+
+		shared := config.Aliases{}
+		if cfg, err := config.LoadConfig(); err == nil {
+			if shared, err = config.LoadSharedAliases(cfg); err != nil {
+				fmt.Printf("Warning: Could not read shared aliases: %v\n", err)
+				shared = config.Aliases{}
+			}
+		}
+
+		if len(personal) == 0 && len(shared) == 0 {
+			fmt.Println("No aliases defined")
+			return
+		}
+
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "ALIAS\tKUBECONFIG\tSCOPE")
+		for _, name := range personal.Names() {
+			fmt.Fprintf(w, "%s\t%s\tpersonal\n", name, personal[name])
+		}
+		for _, name := range shared.Names() {
+			scope := "shared"
+			if _, overridden := personal[name]; overridden {
+				scope = "shared (overridden)"
+			}
+			fmt.Fprintf(w, "%s\t%s\t%s\n", name, shared[name], scope)
+		}
+		w.Flush()
+	},
+}
+
+func init() {
+	aliasSetCmd.Flags().Bool("shared", false, "Store the alias in the bucket for everyone")
+	aliasRmCmd.Flags().Bool("shared", false, "Remove the alias from the bucket")
+	AliasCmd.AddCommand(aliasSetCmd)
+	AliasCmd.AddCommand(aliasListCmd)
+	AliasCmd.AddCommand(aliasRmCmd)
+}
+
+// resolveConfigName resolves a kubeconfig name or alias given to a command
+// that has not loaded the configuration
+func resolveConfigName(name string) (string, error) {
+	if name == "" || strings.HasSuffix(name, ".cfg") {
+		return name, nil
+	}
+	cfg, err := config.LoadConfig()
+	if err != nil {
+		return "", err
+	}
+	return config.ResolveConfigName(cfg, name)
+}
+
+// updateAliases loads the personal or shared aliases, applies update and
+// saves them again
+func updateAliases(shared bool, update func(config.Aliases)) error {
+	if !shared {
+		aliases, err := config.LoadAliases()
+		if err != nil {
+			return err
+		}
+		update(aliases)
+		return aliases.Save()
+	}
+
+	cfg, err := config.LoadConfig()
+	if err != nil {
+		return err
+	}
+	aliases, err := config.LoadSharedAliases(cfg)
+	if err != nil {
+		return err
+	}
+	update(aliases)
+	if err := config.SaveSharedAliases(cfg, aliases); err != nil {
+		return err
+	}
+
+	// Keep completion in step with the bucket
+	if catalog, err := config.LoadCatalog(); err == nil {
+		catalog.Aliases = aliases
+		catalog.Save()
+	}
+	return nil
+}
@@ -0,0 +1,216 @@
+package cmd
+
+import (
+	"fmt"
+	"kubconfig-cli/config"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+var ApproveCmd = &cobra.Command{
+	Use:   "approve [REQUEST_ID]",
+	Short: "Approve another user's pending access request",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		decideRequest(cmd, args[0], true)
+	},
+}
+
+var DenyCmd = &cobra.Command{
+	Use:   "deny [REQUEST_ID]",
+	Short: "Deny another user's pending access request",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		decideRequest(cmd, args[0], false)
+	},
+}
+
+var RequestsCmd = &cobra.Command{
+	Use:   "requests",
+	Short: "List pending access requests",
+	Run: func(cmd *cobra.Command, args []string) {
+		cfg, err := config.LoadConfig()
+		if err != nil {
+			fmt.Printf("Error loading configuration: %v\n", err)
+			return
+		}
+
+		requests, err := config.ListApprovalRequests(cfg)
+		if err != nil {
+			fmt.Printf("Error listing requests: %v\n", err)
+			return
+		}
+
+		showAll, _ := cmd.Flags().GetBool("all")
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "ID\tREQUESTER\tCONFIG\tROLE\tDURATION\tSTATUS\tAGE\tREASON")
+		shown := 0
+		for _, req := range requests {
+			if !showAll && !req.Pending() {
+				continue
+			}
+			role := req.Role
+			if req.Namespace != "" {
+				role += " (" + req.Namespace + ")"
+			}
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\n",
+				req.ID, req.Requester, req.Config, role, req.Duration,
+				requestStatus(req), time.Since(req.CreatedAt).Round(time.Minute), req.Reason)
+			shown++
+		}
+		if shown == 0 {
+			fmt.Println("No pending access requests")
+			return
+		}
+		w.Flush()
+	},
+}
+
+func init() {
+	DenyCmd.Flags().String("reason", "", "Reason for the denial")
+	ApproveCmd.Flags().String("reason", "", "Comment recorded with the approval")
+	RequestsCmd.Flags().Bool("all", false, "Include decided and expired requests")
+}
+
+func decideRequest(cmd *cobra.Command, id string, approve bool) {
+	cfg, err := config.LoadConfig()
+	if err != nil {
+		fmt.Printf("Error loading configuration: %v\n", err)
+		return
+	}
+
+	identity, err := config.LoadIdentity()
+	if err != nil {
+		fmt.Printf("Error loading identity: %v\n", err)
+		return
+	}
+
+	reason, _ := cmd.Flags().GetString("reason")
+	req, err := config.DecideApprovalRequest(cfg, identity, id, approve, reason)
+
+	event := config.NewAuditEvent(config.AuditDeny, nil)
+	if approve {
+		event.Event = config.AuditApprove
+	}
+	event.SessionID = id
+	event.Reason = reason
+	if err != nil {
+		event.Result = config.ResultFailure
+		event.Error = err.Error()
+	} else {
+		event.Config = req.Config
+		event.Role = req.Role
+		event.RoleNamespace = req.Namespace
+		event.Duration = req.Duration
+		event.Details = fmt.Sprintf("request by %s: %s", req.Requester, req.Reason)
+	}
+	recordAudit(event)
+
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return
+	}
+
+	if approve {
+		fmt.Printf("✅ Approved request %s: %s may activate %s as %s for %s (approval valid until %s)\n",
+			req.ID, req.Requester, req.Config, req.Role, req.Duration,
+			req.ApprovalExpiresAt.Local().Format(time.RFC3339))
+	} else {
+		fmt.Printf("❌ Denied request %s by %s for %s\n", req.ID, req.Requester, req.Config)
+	}
+}
+
+func requestStatus(req *config.ApprovalRequest) string {
+	switch {
+	case req.Pending():
+		return config.ApprovalPending
+	case req.Status == config.ApprovalPending:
+		return "expired"
+	case req.Consumed():
+		return "used"
+	case req.Status == config.ApprovalApproved && !req.Approved():
+		return "approval expired"
+	}
+	return req.Status + " by " + req.Approver
+}
+
+// waitForApproval creates or resumes an approval request and polls the
+// bucket until it is approved, denied or the wait times out. It returns the
+// identity the request was made with.
+func waitForApproval(cfg config.Config, req *config.ApprovalRequest, resume bool, wait time.Duration) (*config.Identity, error) {
+	identity, err := config.LoadIdentity()
+	if err != nil {
+		return nil, fmt.Errorf("error loading identity: %v", err)
+	}
+
+	duration, _ := time.ParseDuration(req.Duration)
+	if resume {
+		existing, err := config.GetApprovalRequest(cfg, req.ID)
+		if err != nil {
+			return nil, err
+		}
+		if err := existing.Matches(req.Requester, req.Config, req.Role, req.Namespace, duration); err != nil {
+			return nil, err
+		}
+		req = existing
+	} else {
+		err := config.CreateApprovalRequest(cfg, identity, req)
+
+		event := config.NewAuditEvent(config.AuditRequest, nil)
+		event.SessionID = req.ID
+		event.Config = req.Config
+		event.Role = req.Role
+		event.RoleNamespace = req.Namespace
+		event.Duration = req.Duration
+		event.Reason = req.Reason
+		event.Ticket = req.Ticket
+		if err != nil {
+			event.Result = config.ResultFailure
+			event.Error = err.Error()
+		}
+		recordAudit(event)
+
+		if err != nil {
+			return nil, fmt.Errorf("error creating access request: %v", err)
+		}
+		fmt.Printf("Access to %s requires approval. Created request %s.\n", req.Config, req.ID)
+		fmt.Printf("Ask another user to run: kubconfig approve %s\n", req.ID)
+	}
+
+	deadline := time.Now().Add(wait)
+	for {
+		switch {
+		case req.Approved():
+			fmt.Printf("✅ Request %s approved by %s\n", req.ID, req.Approver)
+			return identity, nil
+		case req.Status == config.ApprovalDenied:
+			msg := fmt.Sprintf("request %s was denied by %s", req.ID, req.Approver)
+			if req.DecisionReason != "" {
+				msg += ": " + req.DecisionReason
+			}
+			return nil, fmt.Errorf("%s", msg)
+		case !req.Pending():
+			return nil, fmt.Errorf("request %s is %s", req.ID, requestStatus(req))
+		case time.Now().After(deadline):
+			return nil, fmt.Errorf("timed out waiting for approval; resume later with --request %s", req.ID)
+		}
+
+		fmt.Printf("\rWaiting for approval of request %s...", req.ID)
+		select {
+		case <-activationInterrupted:
+			return nil, fmt.Errorf("interrupted; resume later with --request %s", req.ID)
+		case <-time.After(5 * time.Second):
+		}
+
+		if req, err = config.GetApprovalRequest(cfg, req.ID); err != nil {
+			fmt.Println()
+			return nil, err
+		}
+		if !req.Pending() {
+			fmt.Print("\r\033[K")
+		}
+	}
+}
@@ -0,0 +1,160 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"kubconfig-cli/config"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+var AuditCmd = &cobra.Command{
+	Use:   "audit",
+	Short: "Search and verify the audit trail of session lifecycle events",
+}
+
+var auditQueryCmd = &cobra.Command{
+	Use:   "query",
+	Short: "Search the audit trail",
+	Run: func(cmd *cobra.Command, args []string) {
+		filter := config.AuditFilter{}
+		filter.User, _ = cmd.Flags().GetString("user")
+		filter.Cluster, _ = cmd.Flags().GetString("cluster")
+		filter.Config, _ = cmd.Flags().GetString("config")
+		filter.SessionID, _ = cmd.Flags().GetString("session")
+		filter.Event, _ = cmd.Flags().GetString("event")
+
+		since, _ := cmd.Flags().GetString("since")
+		var err error
+		if filter.Config, err = resolveConfigName(filter.Config); err != nil {
+			fmt.Printf("Error: %v\n", err)
+			return
+		}
+		if filter.Since, err = config.ParseSince(since); err != nil {
+			fmt.Printf("Error: %v\n", err)
+			return
+		}
+
+		events, err := loadAuditEvents(cmd, filter.Since)
+		if err != nil {
+			fmt.Printf("Error reading audit trail: %v\n", err)
+			return
+		}
+		events = config.FilterAudit(events, filter)
+
+		if output, _ := cmd.Flags().GetString("output"); output == "json" {
+			enc := json.NewEncoder(os.Stdout)
+			for _, e := range events {
+				enc.Encode(e)
+			}
+			return
+		}
+
+		if len(events) == 0 {
+			fmt.Println("No matching audit events")
+			return
+		}
+
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "TIME\tEVENT\tRESULT\tUSER\tHOST\tSESSION\tCONFIG\tROLE\tDURATION\tREASON")
+		for _, e := range events {
+			result := e.Result
+			if e.Error != "" {
+				result += ": " + e.Error
+			}
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\n",
+				e.Time.Local().Format(time.RFC3339), e.Event, result, e.User, e.Host,
+				e.SessionID, e.Config, e.Role, e.Duration, e.Reason)
+		}
+		w.Flush()
+	},
+}
+
+var auditVerifyCmd = &cobra.Command{
+	Use:   "verify",
+	Short: "Check the audit trail's hash chain for removed or edited entries",
+	Run: func(cmd *cobra.Command, args []string) {
+		events, err := loadAuditEvents(cmd, time.Time{})
+		if err != nil {
+			fmt.Printf("Error reading audit trail: %v\n", err)
+			os.Exit(1)
+		}
+
+		var problems []string
+		if bucket, _ := cmd.Flags().GetBool("bucket"); bucket {
+			problems = config.VerifyBucketAuditChain(events)
+		} else {
+			problems = config.VerifyAuditChain(events)
+			if file, _ := cmd.Flags().GetString("file"); file == config.AuditLogFile {
+				cfg, err := config.LoadConfig()
+				if err == nil && cfg.AuditBucket {
+					var anchored []string
+					anchored, err = config.VerifyAuditAnchor(cfg, events)
+					problems = append(problems, anchored...)
+				}
+				if err != nil {
+					fmt.Printf("Warning: Could not check the audit anchor in the bucket: %v\n", err)
+				}
+			}
+		}
+
+		if len(problems) > 0 {
+			fmt.Printf("❌ Audit trail has been tampered with:\n")
+			for _, problem := range problems {
+				fmt.Printf("   - %s\n", problem)
+			}
+			os.Exit(1)
+		}
+		fmt.Printf("✅ Audit trail intact (%d events)\n", len(events))
+	},
+}
+
+func init() {
+	auditQueryCmd.Flags().String("user", "", "Only events of this user")
+	auditQueryCmd.Flags().String("cluster", "", "Only events for this cluster name or server URL")
+	auditQueryCmd.Flags().String("config", "", "Only events for this kubeconfig")
+	auditQueryCmd.Flags().String("session", "", "Only events of this session ID")
+	auditQueryCmd.Flags().String("event", "", "Only events of this type (activate, deactivate, cleanup, request, approve, deny)")
+	auditQueryCmd.Flags().String("since", "", "Only events after this time (e.g. 30d, 12h or 2006-01-02)")
+	auditQueryCmd.RegisterFlagCompletionFunc("config", completeConfigFlag)
+	auditQueryCmd.RegisterFlagCompletionFunc("session", completeSessionFlag)
+	auditQueryCmd.Flags().StringP("output", "o", "table", "Output format: table or json")
+
+	AuditCmd.PersistentFlags().Bool("bucket", false, "Read the shared audit trail in the bucket instead of the local log")
+	AuditCmd.PersistentFlags().String("file", config.AuditLogFile, "Local audit log to read")
+	AuditCmd.AddCommand(auditQueryCmd)
+	AuditCmd.AddCommand(auditVerifyCmd)
+}
+
+// loadAuditEvents reads the local audit log or, with --bucket, the events
+// uploaded to the bucket
+func loadAuditEvents(cmd *cobra.Command, since time.Time) ([]*config.AuditEvent, error) {
+	if bucket, _ := cmd.Flags().GetBool("bucket"); bucket {
+		cfg, err := config.LoadConfig()
+		if err != nil {
+			return nil, err
+		}
+		return config.ReadBucketAudit(cfg, since)
+	}
+
+	file, _ := cmd.Flags().GetString("file")
+	return config.ReadAuditLog(file)
+}
+
+// recordAudit writes an event to the audit trail, warning on failure
+func recordAudit(event *config.AuditEvent) {
+	if err := config.RecordAudit(event); err != nil {
+		fmt.Printf("Warning: Could not write audit log: %v\n", err)
+	}
+}
+
+// notifySession announces a session event to the configured webhooks,
+// warning on failure
+func notifySession(cfg config.Config, event string, session *config.Session) {
+	if err := config.NotifySession(cfg, event, session); err != nil {
+		fmt.Printf("Warning: Could not send notification: %v\n", err)
+	}
+}
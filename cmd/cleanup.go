@@ -47,6 +47,10 @@ var CleanupCmd = &cobra.Command{
 			}
 		}
 
+		event := config.NewAuditEvent(config.AuditCleanup, nil)
+		event.Details = fmt.Sprintf("removed %d cached kubeconfig files older than %d days", cleaned, olderThan)
+		recordAudit(event)
+
 		fmt.Printf("Cleaned up %d cached kubeconfig files\n", cleaned)
 	},
 }
@@ -55,18 +59,30 @@ func init() {
 	CleanupCmd.Flags().IntVarP(&olderThan, "older-than", "o", 30, "Clean up files older than N days")
 }
 
+// cleanupSessions removes session files, keeping those of registered
+// sessions still in use by other shells or commands
 func cleanupSessions() error {
 	files, err := os.ReadDir(config.SessionDir)
 	if err != nil {
 		return err
 	}
 
+	inUse := make(map[string]bool)
+	if registry, err := config.LoadSessionRegistry(); err == nil {
+		for _, session := range registry.Sessions {
+			inUse[session.Kubeconfig] = true
+		}
+	}
+
 	for _, file := range files {
 		if file.IsDir() {
 			continue
 		}
 
 		path := filepath.Join(config.SessionDir, file.Name())
+		if inUse[path] {
+			continue
+		}
 		if err := os.Remove(path); err != nil {
 			fmt.Printf("Error removing %s: %v\n", file.Name(), err)
 			continue
@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"kubconfig-cli/config"
 	"os"
+	"strings"
 
 	"github.com/spf13/cobra"
 )
@@ -38,6 +39,11 @@ var InitCmd = &cobra.Command{
 			fmt.Println("Enabled path-style addressing for S3 compatible service")
 		}
 
+		fmt.Print("Upload audit events to the bucket? (y/N): ")
+		var auditBucket string
+		fmt.Scanln(&auditBucket)
+		cfg.AuditBucket = strings.EqualFold(auditBucket, "y") || strings.EqualFold(auditBucket, "yes")
+
 		// Create necessary directories
 		if err := os.MkdirAll(config.CacheDir, 0755); err != nil {
 			fmt.Printf("Error creating cache directory: %v\n", err)
@@ -0,0 +1,199 @@
+package cmd
+
+import (
+	"fmt"
+	"kubconfig-cli/config"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+// CatalogRefreshCmd refreshes the completion catalog; completions start it
+// in the background when the cached listing is stale
+var CatalogRefreshCmd = &cobra.Command{
+	Use:    "__refresh-catalog",
+	Hidden: true,
+	Args:   cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		unlock, ok := config.LockCatalogRefresh()
+		if !ok {
+			return
+		}
+		defer unlock()
+
+		cfg, err := config.LoadConfig()
+		if err != nil {
+			return
+		}
+		if _, err := config.RefreshCatalog(cfg); err != nil {
+			fmt.Fprintf(os.Stderr, "Error refreshing catalog: %v\n", err)
+		}
+	},
+}
+
+// cachedCatalog returns the cached catalog at once, starting a background
+// refresh when it is stale so the next completion sees current names
+func cachedCatalog() *config.Catalog {
+	catalog, err := config.LoadCatalog()
+	if err != nil {
+		catalog = &config.Catalog{}
+	}
+	if catalog.Stale() {
+		if exe, err := os.Executable(); err == nil {
+			refresh := exec.Command(exe, CatalogRefreshCmd.Use)
+			if refresh.Start() == nil {
+				refresh.Process.Release()
+			}
+		}
+	}
+	return catalog
+}
+
+// completeConfigNames completes the kubeconfig argument of a command
+func completeConfigNames(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	if len(args) > 0 {
+		// Commands run by exec complete like any other command line
+		if cmd.ArgsLenAtDash() >= 0 {
+			return nil, cobra.ShellCompDirectiveDefault
+		}
+		return nil, cobra.ShellCompDirectiveNoFileComp
+	}
+	return completeConfigFlag(cmd, args, toComplete)
+}
+
+// completeConfigList completes commands taking several kubeconfigs,
+// leaving out those already given
+func completeConfigList(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	given := make(map[string]bool)
+	for _, arg := range args {
+		given[arg] = true
+	}
+	names, directive := completeConfigFlag(cmd, args, toComplete)
+	var remaining []string
+	for _, name := range names {
+		value, _, _ := strings.Cut(name, "\t")
+		if !given[value] {
+			remaining = append(remaining, name)
+		}
+	}
+	return remaining, directive
+}
+
+// completeConfigFlag completes flags naming a kubeconfig in the bucket or
+// an alias of one
+func completeConfigFlag(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	catalog := cachedCatalog()
+	names := filterPrefix(catalog.Configs, toComplete)
+	for name, target := range knownAliases(catalog) {
+		if strings.HasPrefix(name, toComplete) {
+			names = append(names, name+"\t"+target)
+		}
+	}
+	return names, cobra.ShellCompDirectiveNoFileComp
+}
+
+// completeAliasNames completes the alias argument of a command
+func completeAliasNames(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	if len(args) > 0 {
+		return nil, cobra.ShellCompDirectiveNoFileComp
+	}
+	var names []string
+	for name, target := range knownAliases(cachedCatalog()) {
+		if strings.HasPrefix(name, toComplete) {
+			names = append(names, name+"\t"+target)
+		}
+	}
+	return names, cobra.ShellCompDirectiveNoFileComp
+}
+
+// knownAliases merges the cached shared aliases with the personal ones,
+// which take precedence
+func knownAliases(catalog *config.Catalog) config.Aliases {
+	aliases := config.Aliases{}
+	for name, target := range catalog.Aliases {
+		aliases[name] = target
+	}
+	if personal, err := config.LoadAliases(); err == nil {
+		for name, target := range personal {
+			aliases[name] = target
+		}
+	}
+	return aliases
+}
+
+// completeRoles completes --role with the roles the bucket policy grants
+func completeRoles(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	roles := cachedCatalog().Roles
+	if len(roles) == 0 {
+		roles = []string{config.DefaultRole}
+	}
+	return filterPrefix(roles, toComplete), cobra.ShellCompDirectiveNoFileComp
+}
+
+// completeContexts completes --context with the contexts of the kubeconfig
+// named by the first argument, if it has been downloaded before
+func completeContexts(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	if len(args) == 0 {
+		return nil, cobra.ShellCompDirectiveNoFileComp
+	}
+	name := args[0]
+	if target, ok := knownAliases(cachedCatalog())[name]; ok {
+		name = target
+	}
+	if config.ValidateKubeconfigName(name) != nil || !config.IsCached(name) {
+		return nil, cobra.ShellCompDirectiveNoFileComp
+	}
+
+	data, err := os.ReadFile(filepath.Join(config.CacheDir, name))
+	if err != nil {
+		return nil, cobra.ShellCompDirectiveNoFileComp
+	}
+	contexts, err := config.KubeconfigContexts(data)
+	if err != nil {
+		return nil, cobra.ShellCompDirectiveNoFileComp
+	}
+	return filterPrefix(contexts, toComplete), cobra.ShellCompDirectiveNoFileComp
+}
+
+// completeSessionIDs completes the session argument of a command with the
+// sessions in the local registry
+func completeSessionIDs(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	if len(args) > 0 {
+		return nil, cobra.ShellCompDirectiveNoFileComp
+	}
+	return completeSessionFlag(cmd, args, toComplete)
+}
+
+// completeSessionFlag completes flags naming a session
+func completeSessionFlag(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	registry, err := config.LoadSessionRegistry()
+	if err != nil {
+		return nil, cobra.ShellCompDirectiveNoFileComp
+	}
+
+	var ids []string
+	for _, session := range registry.Sessions {
+		if !strings.HasPrefix(session.ID, toComplete) {
+			continue
+		}
+		state := "expired"
+		if !session.Expired() {
+			state = compactDuration(session.Remaining()) + " left"
+		}
+		ids = append(ids, fmt.Sprintf("%s\t%s, %s", session.ID, session.Config, state))
+	}
+	return ids, cobra.ShellCompDirectiveNoFileComp
+}
+
+func filterPrefix(values []string, prefix string) []string {
+	var matches []string
+	for _, value := range values {
+		if strings.HasPrefix(value, prefix) {
+			matches = append(matches, value)
+		}
+	}
+	return matches
+}
@@ -11,17 +11,67 @@ import (
 var DeactivateCmd = &cobra.Command{
 	Use:   "deactivate",
 	Short: "Deactivate the current session and revert to default kubeconfig",
+	Long: `Revoke the current session and clear ~/.kube/config. Inside a shell bound to
+a session (KUBCONFIG_SESSION is set) or with --session, only that session is
+revoked and ~/.kube/config is left alone.`,
 	Run: func(cmd *cobra.Command, args []string) {
+		shell, _ := cmd.Flags().GetString("shell-eval")
+		evalOut := os.Stdout
+		if shell != "" {
+			// Only shell code may reach stdout, which the shell evaluates
+			os.Stdout = os.Stderr
+			defer func() { os.Stdout = evalOut }()
+		}
+
 		// Get current kubeconfig path
 		currentConfig := os.Getenv("KUBECONFIG")
 		if currentConfig == "" {
 			currentConfig = config.KubeConfigFile
 		}
 
-		// Get service account info before clearing config
-		saConfig, err := config.GetServiceAccountFromConfig(currentConfig)
+		// Sessions recorded in the registry know how they were created
+		registry, err := config.LoadSessionRegistry()
 		if err != nil {
-			fmt.Printf("Warning: Could not get service account info: %v\n", err)
+			fmt.Printf("Warning: Could not read session registry: %v\n", err)
+			registry = &config.SessionRegistry{}
+		}
+
+		// Sessions private to a shell or file leave the default kubeconfig alone
+		id, _ := cmd.Flags().GetString("session")
+		if id == "" {
+			id = os.Getenv(config.SessionEnv)
+		}
+		if id != "" && id != registry.Current {
+			if session := registry.Get(id); session != nil {
+				closePrivateSession(session)
+				fmt.Printf("Revoked session %s (%s)\n", session.ID, session.Config)
+			} else {
+				fmt.Printf("Warning: Session %s is not registered; it may have expired or been revoked\n", id)
+			}
+			if shell != "" {
+				fmt.Fprint(evalOut, shellEnvCode(shell, []string{"KUBECONFIG", config.SessionEnv}, nil))
+			}
+			return
+		}
+		session := registry.CurrentSession()
+
+		// Otherwise inspect the kubeconfig; impersonation and EKS sessions
+		// have no cluster objects to remove
+		var authMode, impSession string
+		var saConfig *config.ServiceAccountConfig
+		if session == nil {
+			authMode, impSession, err = config.GetSessionAuthMode(currentConfig)
+			if err != nil {
+				fmt.Printf("Warning: Could not read kubeconfig: %v\n", err)
+			}
+
+			// Get service account info before clearing config
+			if authMode == config.AuthServiceAccount {
+				saConfig, err = config.GetServiceAccountFromConfig(currentConfig)
+				if err != nil {
+					fmt.Printf("Warning: Could not get service account info: %v\n", err)
+				}
+			}
 		}
 
 		// Clear the kubeconfig
@@ -30,13 +80,54 @@ var DeactivateCmd = &cobra.Command{
 			return
 		}
 
+		if session != nil {
+			event := config.NewAuditEvent(config.AuditDeactivate, session)
+			if err := config.RevokeSession(session); err != nil {
+				fmt.Printf("Warning: Error revoking session: %v\n", err)
+				event.Result = config.ResultFailure
+				event.Error = err.Error()
+			} else {
+				fmt.Printf("Revoked session %s (%s)\n", session.ID, session.Config)
+			}
+			recordAudit(event)
+			if cfg, err := config.LoadConfig(); err == nil {
+				notifySession(cfg, config.AuditDeactivate, session)
+			}
+			if err := config.UpdateSessionRegistry(func(registry *config.SessionRegistry) {
+				registry.Remove(session.ID)
+			}); err != nil {
+				fmt.Printf("Warning: Could not update session registry: %v\n", err)
+			}
+		}
+
 		// Clean up service account and related resources
 		if saConfig != nil {
+			event := config.NewAuditEvent(config.AuditDeactivate, nil)
+			event.AuthMode = authMode
+			event.ServiceAccount = saConfig.Name
+			event.Namespace = saConfig.Namespace
 			if err := config.CleanupTemporaryAccess(saConfig); err != nil {
 				fmt.Printf("Warning: Error cleaning up resources: %v\n", err)
+				event.Result = config.ResultFailure
+				event.Error = err.Error()
 			} else {
 				fmt.Printf("Cleaned up service account: %s\n", saConfig.Name)
 			}
+			recordAudit(event)
+		}
+
+		if impSession != "" {
+			event := config.NewAuditEvent(config.AuditDeactivate, nil)
+			event.AuthMode = authMode
+			event.SessionID = impSession
+			if err := config.RevokeImpersonation(impSession); err != nil {
+				fmt.Printf("Warning: Error revoking impersonation session: %v\n", err)
+				event.Result = config.ResultFailure
+				event.Error = err.Error()
+			} else {
+				fmt.Printf("Revoked impersonation session: %s\n", impSession)
+			}
+			recordAudit(event)
 		}
 
 		// Clean up session files
@@ -44,11 +135,26 @@ var DeactivateCmd = &cobra.Command{
 			fmt.Printf("Warning: Error cleaning up sessions: %v\n", err)
 		}
 
-		if shellEval, _ := cmd.Flags().GetBool("shell-eval"); shellEval {
-			fmt.Println("unset KUBECONFIG")
+		if shell != "" {
+			fmt.Fprint(evalOut, shellEnvCode(shell, []string{"KUBECONFIG", config.SessionEnv}, nil))
 			return
 		}
 
 		fmt.Println("Successfully deactivated session")
+		if registry, err := config.LoadSessionRegistry(); err == nil {
+			for _, other := range registry.Sessions {
+				if other.Switchable() && !other.Expired() {
+					fmt.Println("Other sessions are still active; see 'kubconfig ls-active' and 'kubconfig use'")
+					break
+				}
+			}
+		}
 	},
 }
+
+func init() {
+	DeactivateCmd.Flags().String("session", "", "Revoke this session instead of the current one")
+	DeactivateCmd.Flags().String("shell-eval", "", "Print shell code (sh, bash, zsh or fish) unsetting KUBECONFIG")
+	DeactivateCmd.Flags().Lookup("shell-eval").NoOptDefVal = "sh"
+	DeactivateCmd.RegisterFlagCompletionFunc("session", completeSessionFlag)
+}
@@ -0,0 +1,232 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"kubconfig-cli/config"
+	"os"
+	"os/exec"
+	"os/signal"
+	"path/filepath"
+	"syscall"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+var ExecCmd = &cobra.Command{
+	Use:   "exec [KUBECONFIG_NAME] -- COMMAND [ARGS...]",
+	Short: "Run a single command under an ephemeral session",
+	Long: `Activate a session in a private kubeconfig, run a command with KUBECONFIG
+pointing at it and revoke the session as soon as the command exits or is
+interrupted. The command's exit code is passed on and ~/.kube/config is left
+untouched. Activation messages go to stderr so the command's output can be
+piped.`,
+	Example: `  kubconfig exec prod.cfg --duration 15m --role view -- kubectl get pods -A`,
+	Args: func(cmd *cobra.Command, args []string) error {
+		if cmd.ArgsLenAtDash() != 1 || len(args) < 2 {
+			return fmt.Errorf("usage: kubconfig exec KUBECONFIG_NAME [flags] -- COMMAND [ARGS...]")
+		}
+		return nil
+	},
+	ValidArgsFunction: completeConfigNames,
+	Run: func(cmd *cobra.Command, args []string) {
+		opts := activateOptions{Config: args[0]}
+		opts.Duration, _ = cmd.Flags().GetDuration("duration")
+		opts.Role, _ = cmd.Flags().GetString("role")
+		opts.RoleSet = cmd.Flags().Changed("role")
+		opts.Namespace, _ = cmd.Flags().GetString("namespace")
+		opts.Context, _ = cmd.Flags().GetString("context")
+		opts.Reason, _ = cmd.Flags().GetString("reason")
+		opts.Ticket, _ = cmd.Flags().GetString("ticket")
+		opts.AuthMode, _ = cmd.Flags().GetString("auth")
+		opts.Wait, _ = cmd.Flags().GetDuration("wait")
+		if opts.Duration < 0 {
+			fmt.Fprintln(os.Stderr, "Error: valid duration is required (e.g., --duration 15m)")
+			os.Exit(1)
+		}
+
+		cfg, err := config.LoadConfig()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error loading configuration: %v\n", err)
+			os.Exit(1)
+		}
+
+		// Catch signals before activating, so an interrupted activation is
+		// revoked rather than left behind
+		signals := catchSignals()
+		session, err := startGuardedSession(cfg, opts, signals)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error activating %s: %v\n", opts.Config, err)
+			os.Exit(1)
+		}
+		os.Exit(execUnderSession(session, args[1:], signals))
+	},
+}
+
+// execUnderSession runs a command with KUBECONFIG pointing at a private
+// session and revokes the session when it exits, returning its exit code
+func execUnderSession(session *config.Session, command []string, signals chan os.Signal) int {
+	// Signals stay caught, and are dropped, until the session is revoked, so
+	// a second Ctrl+C does not interrupt the revocation
+	defer func() {
+		closePrivateSession(session)
+		signal.Stop(signals)
+	}()
+
+	child := exec.Command(command[0], command[1:]...)
+	child.Env = sessionEnviron(session)
+	child.Stdin, child.Stdout, child.Stderr = os.Stdin, os.Stdout, os.Stderr
+	code, err := runForwardingSignals(child, signals)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error running %s: %v\n", command[0], err)
+	}
+	return code
+}
+
+func init() {
+	ExecCmd.Flags().Duration("duration", 0, "Session duration (e.g., 15m; default from policy)")
+	ExecCmd.Flags().String("role", "", "ClusterRole to grant (default from policy, otherwise cluster-admin)")
+	ExecCmd.Flags().StringP("namespace", "n", "", "Only grant the role within this namespace")
+	ExecCmd.Flags().String("context", "", "Context of the kubeconfig to activate (default: its current context)")
+	ExecCmd.Flags().String("reason", "", "Reason for the activation")
+	ExecCmd.Flags().String("ticket", "", "Ticket reference (default: first ticket ID found in the reason)")
+	ExecCmd.Flags().String("auth", config.AuthAuto, "Authentication mode: auto, serviceaccount, impersonate, eks or exec")
+	ExecCmd.Flags().Duration("wait", 30*time.Minute, "How long to wait for approval")
+	ExecCmd.RegisterFlagCompletionFunc("role", completeRoles)
+	ExecCmd.RegisterFlagCompletionFunc("context", completeContexts)
+}
+
+// activationInterrupted is closed when a signal interrupts activating a
+// private session, which stops waiting for approval
+var activationInterrupted = make(chan struct{})
+
+// catchSignals starts catching the signals passed on to commands run under
+// a session
+func catchSignals() chan os.Signal {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM, syscall.SIGHUP, syscall.SIGQUIT)
+	return signals
+}
+
+// startGuardedSession starts a private session while signals are caught.
+// A signal arriving during activation aborts it and revokes the session if
+// it was created anyway.
+func startGuardedSession(cfg config.Config, opts activateOptions, signals chan os.Signal) (*config.Session, error) {
+	done := make(chan struct{})
+	interrupted := make(chan os.Signal, 1)
+	go func() {
+		select {
+		case sig := <-signals:
+			interrupted <- sig
+			close(activationInterrupted)
+		case <-done:
+		}
+	}()
+
+	session, err := startPrivateSession(cfg, opts)
+	close(done)
+
+	select {
+	case sig := <-interrupted:
+		if session != nil {
+			closePrivateSession(session)
+		}
+		return nil, fmt.Errorf("interrupted by %v", sig)
+	default:
+	}
+	return session, err
+}
+
+// startPrivateSession activates a session into its own file under the
+// session directory and registers it without making it the current one
+func startPrivateSession(cfg config.Config, opts activateOptions) (*config.Session, error) {
+	// Keep stdout free for the command run under the session
+	stdout := os.Stdout
+	os.Stdout = os.Stderr
+	session, kubeconfig, err := activateSessionOrGroup(cfg, opts)
+	os.Stdout = stdout
+	if err != nil {
+		return nil, err
+	}
+
+	session.Kubeconfig = config.GetSessionConfig(session.ID)
+	err = os.MkdirAll(config.SessionDir, 0700)
+	if err == nil {
+		err = os.WriteFile(session.Kubeconfig, kubeconfig, 0600)
+	}
+	if err != nil {
+		closePrivateSession(session)
+		return nil, fmt.Errorf("error saving kubeconfig: %v", err)
+	}
+
+	err = config.UpdateSessionRegistry(func(registry *config.SessionRegistry) {
+		registry.Add(session)
+	})
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: Could not record session: %v\n", err)
+	}
+	return session, nil
+}
+
+// closePrivateSession revokes a session started by startPrivateSession and
+// deletes its kubeconfig. Kubeconfigs outside the session directory, e.g.
+// issued ones, are left in place.
+func closePrivateSession(session *config.Session) {
+	stdout := os.Stdout
+	os.Stdout = os.Stderr
+	defer func() { os.Stdout = stdout }()
+
+	if err := endSession(session); err != nil {
+		fmt.Printf("Warning: Could not revoke session %s: %v (retry with 'kubconfig revoke %s')\n", session.ID, err, session.ID)
+	}
+	if filepath.Dir(session.Kubeconfig) != config.SessionDir {
+		return
+	}
+	if err := os.Remove(session.Kubeconfig); err != nil && !os.IsNotExist(err) {
+		fmt.Printf("Warning: Could not remove %s: %v\n", session.Kubeconfig, err)
+	}
+}
+
+// sessionEnviron returns the environment with KUBECONFIG pointing at a
+// session's private kubeconfig
+func sessionEnviron(session *config.Session) []string {
+	return append(os.Environ(),
+		"KUBECONFIG="+session.Kubeconfig,
+		config.SessionEnv+"="+session.ID)
+}
+
+// runForwardingSignals runs a command, passing on the signals caught by
+// catchSignals, and returns its exit code the way a shell reports it. The
+// signals stay caught afterwards; the caller stops them once cleaned up.
+func runForwardingSignals(child *exec.Cmd, signals chan os.Signal) (int, error) {
+	if err := child.Start(); err != nil {
+		return 127, err
+	}
+
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		for {
+			select {
+			case sig := <-signals:
+				child.Process.Signal(sig)
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	err := child.Wait()
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		if status, ok := exitErr.Sys().(syscall.WaitStatus); ok && status.Signaled() {
+			return 128 + int(status.Signal()), nil
+		}
+		return exitErr.ExitCode(), nil
+	}
+	if err != nil {
+		return 1, err
+	}
+	return 0, nil
+}
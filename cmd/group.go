@@ -0,0 +1,300 @@
+package cmd
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"kubconfig-cli/config"
+	"os"
+	"os/exec"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+// memberResult is what __activate-member reports back to the group
+// activation on stdout
+type memberResult struct {
+	Session    *config.Session `json:"session,omitempty"`
+	Kubeconfig []byte          `json:"kubeconfig,omitempty"`
+	Error      string          `json:"error,omitempty"`
+}
+
+// ActivateMemberCmd activates one kubeconfig of a group. The options are
+// read from stdin, so the member never prompts, and the result is written
+// to stdout while progress goes to stderr.
+var ActivateMemberCmd = &cobra.Command{
+	Use:    "__activate-member",
+	Hidden: true,
+	Args:   cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		out := json.NewEncoder(os.Stdout)
+		os.Stdout = os.Stderr
+
+		var opts activateOptions
+		if err := json.NewDecoder(os.Stdin).Decode(&opts); err != nil {
+			out.Encode(memberResult{Error: fmt.Sprintf("error reading options: %v", err)})
+			return
+		}
+		cfg, err := config.LoadConfig()
+		if err != nil {
+			out.Encode(memberResult{Error: fmt.Sprintf("error loading configuration: %v", err)})
+			return
+		}
+
+		session, kubeconfig, err := activateSession(cfg, opts)
+		if err != nil {
+			out.Encode(memberResult{Error: err.Error()})
+			return
+		}
+		out.Encode(memberResult{Session: session, Kubeconfig: kubeconfig})
+	},
+}
+
+// groupMembers returns the kubeconfigs named on the command line, resolving
+// aliases, together with those carrying all of the given tags
+func groupMembers(cfg config.Config, names []string, tags map[string]string) ([]string, error) {
+	var members []string
+	seen := make(map[string]bool)
+	add := func(name string) {
+		if !seen[name] {
+			members = append(members, name)
+			seen[name] = true
+		}
+	}
+
+	for _, name := range names {
+		if name == "-" {
+			return nil, fmt.Errorf("\"-\" cannot be combined with other kubeconfigs")
+		}
+		resolved, err := config.ResolveConfigName(cfg, name)
+		if err != nil {
+			return nil, err
+		}
+		add(resolved)
+	}
+
+	if len(tags) > 0 {
+		catalog, err := config.LoadCatalog()
+		if err != nil || catalog.Stale() {
+			if catalog, err = config.RefreshCatalog(cfg); err != nil {
+				return nil, fmt.Errorf("error listing kubeconfigs: %v", err)
+			}
+		}
+		matching := catalog.Matching(tags)
+		if len(matching) == 0 {
+			return nil, fmt.Errorf("no kubeconfigs tagged %s", formatTags(tags))
+		}
+		for _, name := range matching {
+			add(name)
+		}
+	}
+	return members, nil
+}
+
+// formatTags formats tags as sorted key=value pairs
+func formatTags(tags map[string]string) string {
+	var pairs []string
+	for key, value := range tags {
+		pairs = append(pairs, key+"="+value)
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, ",")
+}
+
+// activateSessionOrGroup activates a single kubeconfig or, when opts names
+// a group, all of them into one merged kubeconfig
+func activateSessionOrGroup(cfg config.Config, opts activateOptions) (*config.Session, []byte, error) {
+	if len(opts.Group) > 0 {
+		return activateGroup(cfg, opts)
+	}
+	return activateSession(cfg, opts)
+}
+
+// activateGroup activates every kubeconfig of opts.Group in its own
+// process, at most opts.Parallel at a time, and merges the member
+// kubeconfigs into one with a context per kubeconfig. The group session
+// holds the member sessions so they are revoked together.
+func activateGroup(cfg config.Config, opts activateOptions) (*config.Session, []byte, error) {
+	if opts.RequestID != "" {
+		return nil, nil, fmt.Errorf("--request cannot be used when activating several kubeconfigs")
+	}
+	parallel := opts.Parallel
+	if parallel < 1 {
+		parallel = 1
+	}
+
+	// Members cannot prompt, so ask for the reason once for all of them
+	if opts.Reason == "" && isInteractive() {
+		opts.Reason = promptLine("Reason for access (may be required by policy): ")
+	}
+
+	fmt.Printf("Activating %d kubeconfigs, %d at a time\n", len(opts.Group), parallel)
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	slots := make(chan struct{}, parallel)
+	results := make([]memberResult, len(opts.Group))
+	for i, name := range opts.Group {
+		wg.Add(1)
+		go func(i int, name string) {
+			defer wg.Done()
+			slots <- struct{}{}
+			defer func() { <-slots }()
+
+			memberOpts := opts
+			memberOpts.Config = name
+			memberOpts.Group = nil
+			results[i] = runGroupMember(memberOpts, &mu)
+		}(i, name)
+	}
+	wg.Wait()
+
+	group := &config.Session{
+		ID:        config.NewSessionID(),
+		AuthMode:  config.AuthGroup,
+		Reason:    opts.Reason,
+		Ticket:    opts.Ticket,
+		CreatedAt: time.Now(),
+	}
+	var configs, contexts []string
+	var kubeconfigs [][]byte
+	var failed []string
+	for i, result := range results {
+		name := opts.Group[i]
+		if result.Error != "" {
+			failed = append(failed, name)
+			fmt.Printf("  FAILED  %s: %s\n", name, result.Error)
+			continue
+		}
+		fmt.Printf("  OK      %s (session %s, expires at %s)\n",
+			name, result.Session.ID, result.Session.ExpiresAt.Format(time.RFC3339))
+
+		group.Members = append(group.Members, result.Session)
+		configs = append(configs, name)
+		contexts = append(contexts, strings.TrimSuffix(name, ".cfg"))
+		kubeconfigs = append(kubeconfigs, result.Kubeconfig)
+		if result.Session.ExpiresAt.After(group.ExpiresAt) {
+			group.ExpiresAt = result.Session.ExpiresAt
+		}
+	}
+	if len(group.Members) == 0 {
+		return nil, nil, fmt.Errorf("none of the %d kubeconfigs could be activated", len(opts.Group))
+	}
+
+	group.Config = strings.Join(configs, ", ")
+	group.User = group.Members[0].User
+	group.Role = group.Members[0].Role
+	for _, member := range group.Members[1:] {
+		if member.Role != group.Role {
+			group.Role = ""
+		}
+	}
+
+	merged, err := config.MergeKubeconfigs(contexts, kubeconfigs)
+	if err != nil {
+		// The members are of no use without the merged kubeconfig
+		if err := config.RevokeSession(group); err != nil {
+			fmt.Printf("Warning: Could not revoke member sessions: %v\n", err)
+		}
+		return nil, nil, fmt.Errorf("error merging kubeconfigs: %v", err)
+	}
+
+	recordAudit(config.NewAuditEvent(config.AuditActivateGroup, group))
+
+	fmt.Printf("Activated %d of %d kubeconfigs as group session %s; contexts: %s\n",
+		len(group.Members), len(opts.Group), group.ID, strings.Join(contexts, ", "))
+	if len(failed) > 0 {
+		fmt.Printf("Not activated: %s\n", strings.Join(failed, ", "))
+	}
+	return group, merged, nil
+}
+
+// contextSession returns the member of a group session behind a context of
+// its merged kubeconfig, or the session itself
+func contextSession(session *config.Session, context string) *config.Session {
+	for _, member := range session.Members {
+		if strings.TrimSuffix(member.Config, ".cfg") == context {
+			return member
+		}
+	}
+	return session
+}
+
+// runGroupMember activates one kubeconfig of a group in a child process,
+// printing its progress prefixed with the kubeconfig name
+func runGroupMember(opts activateOptions, mu *sync.Mutex) memberResult {
+	exe, err := os.Executable()
+	if err != nil {
+		return memberResult{Error: err.Error()}
+	}
+	input, err := json.Marshal(opts)
+	if err != nil {
+		return memberResult{Error: err.Error()}
+	}
+
+	var stdout bytes.Buffer
+	child := exec.Command(exe, ActivateMemberCmd.Use)
+	child.Stdin = bytes.NewReader(input)
+	child.Stdout = &stdout
+	stderr, err := child.StderrPipe()
+	if err != nil {
+		return memberResult{Error: err.Error()}
+	}
+	if err := child.Start(); err != nil {
+		return memberResult{Error: fmt.Sprintf("error starting activation: %v", err)}
+	}
+
+	scanner := bufio.NewScanner(stderr)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		mu.Lock()
+		fmt.Printf("[%s] %s\n", opts.Config, line)
+		mu.Unlock()
+	}
+	waitErr := child.Wait()
+
+	var result memberResult
+	if err := json.Unmarshal(stdout.Bytes(), &result); err != nil {
+		return memberResult{Error: fmt.Sprintf("activation did not complete: %v", waitErr)}
+	}
+	return result
+}
+
+// completeTags completes key=value tags of the kubeconfigs in the catalog
+func completeTags(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	seen := make(map[string]bool)
+	var tags []string
+	for _, objectTags := range cachedCatalog().Tags {
+		for key, value := range objectTags {
+			tag := key + "=" + value
+			if !seen[tag] && strings.HasPrefix(tag, toComplete) {
+				tags = append(tags, tag)
+				seen[tag] = true
+			}
+		}
+	}
+	sort.Strings(tags)
+	return tags, cobra.ShellCompDirectiveNoFileComp
+}
+
+// completeRegions completes the region tags of the kubeconfigs in the catalog
+func completeRegions(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	seen := make(map[string]bool)
+	var regions []string
+	for _, objectTags := range cachedCatalog().Tags {
+		if region := objectTags["region"]; region != "" && !seen[region] && strings.HasPrefix(region, toComplete) {
+			regions = append(regions, region)
+			seen[region] = true
+		}
+	}
+	sort.Strings(regions)
+	return regions, cobra.ShellCompDirectiveNoFileComp
+}
@@ -0,0 +1,85 @@
+package cmd
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"kubconfig-cli/config"
+	"net"
+	"os"
+	"os/exec"
+	"os/signal"
+	"strings"
+	"syscall"
+
+	"github.com/spf13/cobra"
+)
+
+// ImpersonationProxyCmd serves the impersonation proxy of one session until
+// it expires or is revoked. The proxy is read from stdin, so the master
+// credential never appears on the command line, and the listen address is
+// written to stdout.
+var ImpersonationProxyCmd = &cobra.Command{
+	Use:    "__impersonation-proxy",
+	Hidden: true,
+	Args:   cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		signal.Ignore(os.Interrupt, syscall.SIGHUP)
+
+		var proxy config.ImpersonationProxy
+		if err := json.NewDecoder(os.Stdin).Decode(&proxy); err != nil {
+			fmt.Fprintf(os.Stderr, "Error reading impersonation proxy: %v\n", err)
+			os.Exit(1)
+		}
+		listener, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error listening: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Println(listener.Addr().String())
+		os.Stdout.Close()
+
+		if err := proxy.Serve(listener); err != nil {
+			os.Exit(1)
+		}
+	},
+}
+
+// startImpersonationProxy runs the proxy of an impersonation session in a
+// detached process and returns the address it listens on
+func startImpersonationProxy(proxy *config.ImpersonationProxy) (string, error) {
+	exe, err := os.Executable()
+	if err != nil {
+		return "", err
+	}
+	input, err := json.Marshal(proxy)
+	if err != nil {
+		return "", err
+	}
+
+	child := exec.Command(exe, ImpersonationProxyCmd.Use)
+	child.Stdin = strings.NewReader(string(input))
+	child.SysProcAttr = &syscall.SysProcAttr{Setsid: true}
+	stdout, err := child.StdoutPipe()
+	if err != nil {
+		return "", err
+	}
+	if err := child.Start(); err != nil {
+		return "", fmt.Errorf("error starting impersonation proxy: %v", err)
+	}
+
+	address, err := bufio.NewReader(stdout).ReadString('\n')
+	if err != nil {
+		child.Process.Kill()
+		child.Wait()
+		return "", fmt.Errorf("impersonation proxy did not start")
+	}
+	child.Process.Release()
+
+	address = strings.TrimSpace(address)
+	state := &config.ProxyState{Address: address, Token: proxy.Token, ExpiresAt: proxy.ExpiresAt}
+	if err := config.SaveProxyState(proxy.SessionID, state); err != nil {
+		return "", fmt.Errorf("error saving impersonation proxy: %v", err)
+	}
+	return address, nil
+}
@@ -0,0 +1,231 @@
+package cmd
+
+import (
+	"fmt"
+	"kubconfig-cli/config"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+var IssueCmd = &cobra.Command{
+	Use:   "issue [KUBECONFIG_NAME]",
+	Short: "Issue credentials for use outside your own kubeconfig",
+	Long: `Write a minimal, self-contained kubeconfig for a kubeconfig from the bucket,
+e.g. for a CI pipeline or a managed-service customer. A dedicated
+ServiceAccount and binding are created for it and the kubeconfig only holds
+that cluster's CA and a token expiring with the session. Your own kubeconfig
+is left untouched.
+
+Issued kubeconfigs are recorded in the session registry; see 'issue list'
+and 'revoke'.`,
+	Example:           `  kubconfig issue prod.cfg --duration 2h --role view --namespace team-a -o out.kubeconfig`,
+	Args:              cobra.ExactArgs(1),
+	ValidArgsFunction: completeConfigNames,
+	Run: func(cmd *cobra.Command, args []string) {
+		output, _ := cmd.Flags().GetString("output")
+		if output == "" {
+			fmt.Println("Error: an output file is required (e.g., -o out.kubeconfig)")
+			return
+		}
+
+		opts := activateOptions{Config: args[0], AuthMode: config.AuthServiceAccount, Issue: true}
+		opts.Duration, _ = cmd.Flags().GetDuration("duration")
+		opts.Role, _ = cmd.Flags().GetString("role")
+		opts.RoleSet = cmd.Flags().Changed("role")
+		opts.Namespace, _ = cmd.Flags().GetString("namespace")
+		opts.Context, _ = cmd.Flags().GetString("context")
+		opts.Reason, _ = cmd.Flags().GetString("reason")
+		opts.Ticket, _ = cmd.Flags().GetString("ticket")
+		opts.RequestID, _ = cmd.Flags().GetString("request")
+		opts.Wait, _ = cmd.Flags().GetDuration("wait")
+		opts.Audiences, _ = cmd.Flags().GetStringSlice("audience")
+		if opts.Duration < 0 {
+			fmt.Println("Error: valid duration is required (e.g., --duration 2h)")
+			return
+		}
+
+		cfg, err := config.LoadConfig()
+		if err != nil {
+			fmt.Printf("Error loading configuration: %v\n", err)
+			return
+		}
+
+		session, kubeconfig, err := activateSession(cfg, opts)
+		if err != nil {
+			fmt.Printf("Error issuing kubeconfig for %s: %v\n", opts.Config, err)
+			return
+		}
+
+		if err := os.WriteFile(output, kubeconfig, 0600); err != nil {
+			fmt.Printf("Error saving kubeconfig: %v\n", err)
+			return
+		}
+
+		// Record the session without making it the current one
+		session.Kubeconfig = output
+		if abs, err := filepath.Abs(output); err == nil {
+			session.Kubeconfig = abs
+		}
+		err = config.UpdateSessionRegistry(func(registry *config.SessionRegistry) {
+			registry.Add(session)
+		})
+		if err != nil {
+			fmt.Printf("Warning: Could not record session: %v\n", err)
+		}
+
+		fmt.Printf("Issued %s for '%s' as session %s (expires at %s)\n",
+			output, session.Config, session.ID, session.ExpiresAt.Format(time.RFC3339))
+		fmt.Printf("Revoke it early with: kubconfig revoke %s\n", session.ID)
+	},
+}
+
+var issueListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List issued and shared kubeconfigs",
+	Args:  cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		registry, err := config.LoadSessionRegistry()
+		if err != nil {
+			fmt.Printf("Error reading session registry: %v\n", err)
+			return
+		}
+
+		var issued []*config.Session
+		for _, session := range registry.Sessions {
+			if session.Issued {
+				issued = append(issued, session)
+			}
+		}
+		if len(issued) == 0 {
+			fmt.Println("No issued kubeconfigs")
+			return
+		}
+
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "SESSION\tCONFIG\tSERVICEACCOUNT\tROLE\tNAMESPACE\tEXPIRES\tKUBECONFIG")
+		for _, session := range issued {
+			expires := "expired"
+			if !session.Expired() {
+				expires = "in " + compactDuration(session.Remaining())
+			}
+			namespace := session.RoleNamespace
+			if namespace == "" {
+				namespace = "(cluster-wide)"
+			}
+			kubeconfig := session.Kubeconfig
+			if session.SharedWith != "" {
+				kubeconfig = "shared with " + session.SharedWith
+			}
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\t%s\n",
+				session.ID, session.Config, session.ServiceAccount, session.Role, namespace, expires, kubeconfig)
+		}
+		w.Flush()
+	},
+}
+
+var issueTokenCmd = &cobra.Command{
+	Use:   "token [SESSION_ID]",
+	Short: "Mint a purpose-scoped token for a session's ServiceAccount",
+	Long: `Mint a token for the ServiceAccount of a session (default: the current
+session) that is only valid for the given audiences, e.g. a CI job or a vault
+plugin. Tokens never outlive the session and, when bound to a Pod or Secret
+with --bound-object-kind/--bound-object-name, stop working once that object is
+deleted. The token is printed to stdout.`,
+	Args:              cobra.MaximumNArgs(1),
+	ValidArgsFunction: completeSessionIDs,
+	Run: func(cmd *cobra.Command, args []string) {
+		registry, err := config.LoadSessionRegistry()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error reading session registry: %v\n", err)
+			os.Exit(1)
+		}
+
+		session := registry.CurrentSession()
+		if len(args) == 1 {
+			session = registry.Get(args[0])
+		}
+		switch {
+		case session == nil:
+			fmt.Fprintln(os.Stderr, "Error: no such session; activate a kubeconfig first")
+			os.Exit(1)
+		case session.AuthMode != config.AuthServiceAccount:
+			fmt.Fprintf(os.Stderr, "Error: session %s uses %s authentication; tokens can only be issued for %s sessions\n",
+				session.ID, session.AuthMode, config.AuthServiceAccount)
+			os.Exit(1)
+		case session.Expired():
+			fmt.Fprintf(os.Stderr, "Error: session %s has expired\n", session.ID)
+			os.Exit(1)
+		}
+
+		opts := config.TokenOptions{ExpiresAt: session.ExpiresAt}
+		opts.Audiences, _ = cmd.Flags().GetStringSlice("audience")
+		opts.BoundObjectKind, _ = cmd.Flags().GetString("bound-object-kind")
+		opts.BoundObjectName, _ = cmd.Flags().GetString("bound-object-name")
+		if len(opts.Audiences) == 0 {
+			fmt.Fprintln(os.Stderr, "Error: at least one --audience is required")
+			os.Exit(1)
+		}
+		if duration, _ := cmd.Flags().GetDuration("duration"); duration > 0 {
+			if expiresAt := time.Now().Add(duration); expiresAt.Before(opts.ExpiresAt) {
+				opts.ExpiresAt = expiresAt
+			} else {
+				fmt.Fprintf(os.Stderr, "Warning: Token limited to the session expiry (%s)\n", session.Remaining().Round(time.Second))
+			}
+		}
+
+		var token string
+		err = config.WithMasterKubeconfig(session.Config, session.Context, func() error {
+			token, err = config.IssueToken(session.ServiceAccountConfig(), opts)
+			return err
+		})
+
+		event := config.NewAuditEvent(config.AuditIssue, session)
+		event.ExpiresAt = opts.ExpiresAt
+		event.Details = fmt.Sprintf("token for audiences %s", strings.Join(opts.Audiences, ", "))
+		if opts.BoundObjectKind != "" {
+			event.Details += fmt.Sprintf(" bound to %s %s", opts.BoundObjectKind, opts.BoundObjectName)
+		}
+		if err != nil {
+			event.Result = config.ResultFailure
+			event.Error = err.Error()
+		}
+		if auditErr := config.RecordAudit(event); auditErr != nil {
+			fmt.Fprintf(os.Stderr, "Warning: Could not write audit log: %v\n", auditErr)
+		}
+
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error issuing token: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Fprintf(os.Stderr, "Issued token for %s (audiences: %s, expires %s)\n",
+			session.ServiceAccount, strings.Join(opts.Audiences, ", "), opts.ExpiresAt.Local().Format(time.RFC3339))
+		fmt.Println(token)
+	},
+}
+
+func init() {
+	IssueCmd.Flags().Duration("duration", 0, "Lifetime of the kubeconfig (e.g., 2h; default from policy)")
+	IssueCmd.Flags().String("role", "", "ClusterRole to grant (default from policy, otherwise cluster-admin)")
+	IssueCmd.Flags().StringP("namespace", "n", "", "Only grant the role within this namespace")
+	IssueCmd.Flags().String("context", "", "Context of the kubeconfig to activate (default: its current context)")
+	IssueCmd.Flags().StringP("output", "o", "", "File to write the kubeconfig to")
+	IssueCmd.Flags().String("reason", "", "Reason for issuing the kubeconfig")
+	IssueCmd.Flags().String("ticket", "", "Ticket reference (default: first ticket ID found in the reason)")
+	IssueCmd.Flags().String("request", "", "Resume waiting for an earlier approval request")
+	IssueCmd.Flags().Duration("wait", 30*time.Minute, "How long to wait for approval")
+	IssueCmd.Flags().StringSlice("audience", nil, "Additional audiences of the token, besides the API server")
+	IssueCmd.RegisterFlagCompletionFunc("role", completeRoles)
+	IssueCmd.RegisterFlagCompletionFunc("context", completeContexts)
+	IssueCmd.AddCommand(issueListCmd)
+
+	issueTokenCmd.Flags().StringSlice("audience", nil, "Audience the token is valid for (repeatable)")
+	issueTokenCmd.Flags().String("bound-object-kind", "", "Bind the token to a Pod or Secret")
+	issueTokenCmd.Flags().String("bound-object-name", "", "Name of the bound Pod or Secret, in the ServiceAccount's namespace")
+	issueTokenCmd.Flags().Duration("duration", 0, "Token lifetime (default: until the session expires)")
+	IssueCmd.AddCommand(issueTokenCmd)
+}
@@ -0,0 +1,135 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"kubconfig-cli/config"
+	"os"
+
+	"github.com/spf13/cobra"
+)
+
+var KeysCmd = &cobra.Command{
+	Use:   "keys",
+	Short: "Manage the public keys kubeconfigs are shared to",
+}
+
+var keysRegisterCmd = &cobra.Command{
+	Use:   "register",
+	Short: "Register your public key in the bucket so others can share kubeconfigs with you",
+	Long: `Register your public key under keys/ in the bucket. --name renames your local
+identity first, e.g. to your email address.
+
+Users without bucket access can run 'kubconfig keys export > me.json' and
+send the file to someone who registers it with 'keys register --file me.json'.`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		cfg, err := config.LoadConfig()
+		if err != nil {
+			fmt.Printf("Error loading configuration: %v\n", err)
+			return
+		}
+
+		var public *config.PublicIdentity
+		if file, _ := cmd.Flags().GetString("file"); file != "" {
+			data, err := os.ReadFile(file)
+			if err != nil {
+				fmt.Printf("Error reading key: %v\n", err)
+				return
+			}
+			public = &config.PublicIdentity{}
+			if err := json.Unmarshal(data, public); err != nil {
+				fmt.Printf("Error parsing key: %v\n", err)
+				return
+			}
+		} else {
+			identity, err := loadNamedIdentity(cmd)
+			if err != nil {
+				fmt.Printf("Error loading identity: %v\n", err)
+				return
+			}
+			if public, err = identity.Public(); err != nil {
+				fmt.Printf("Error loading identity: %v\n", err)
+				return
+			}
+		}
+
+		if err := config.RegisterPublicIdentity(cfg, public); err != nil {
+			fmt.Printf("Error registering key: %v\n", err)
+			return
+		}
+		fmt.Printf("Registered key for %s\n", public.Name)
+	},
+}
+
+var keysExportCmd = &cobra.Command{
+	Use:   "export",
+	Short: "Print your public key for registration by someone with bucket access",
+	Args:  cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		identity, err := loadNamedIdentity(cmd)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error loading identity: %v\n", err)
+			os.Exit(1)
+		}
+		public, err := identity.Public()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error loading identity: %v\n", err)
+			os.Exit(1)
+		}
+		data, _ := json.MarshalIndent(public, "", "  ")
+		fmt.Println(string(data))
+	},
+}
+
+var keysListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List registered keys",
+	Args:  cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		cfg, err := config.LoadConfig()
+		if err != nil {
+			fmt.Printf("Error loading configuration: %v\n", err)
+			return
+		}
+		names, err := config.ListPublicIdentities(cfg)
+		if err != nil {
+			fmt.Printf("Error listing keys: %v\n", err)
+			return
+		}
+		if len(names) == 0 {
+			fmt.Println("No registered keys")
+			return
+		}
+		for _, name := range names {
+			fmt.Println(name)
+		}
+	},
+}
+
+func init() {
+	keysRegisterCmd.Flags().String("name", "", "Rename your identity before registering, e.g. to your email address")
+	keysRegisterCmd.Flags().String("file", "", "Register a public key exported by someone else")
+	keysExportCmd.Flags().String("name", "", "Rename your identity before exporting, e.g. to your email address")
+	KeysCmd.AddCommand(keysRegisterCmd)
+	KeysCmd.AddCommand(keysExportCmd)
+	KeysCmd.AddCommand(keysListCmd)
+}
+
+// loadNamedIdentity loads the local identity, renaming it with --name
+func loadNamedIdentity(cmd *cobra.Command) (*config.Identity, error) {
+	identity, err := config.LoadIdentity()
+	if err != nil {
+		return nil, err
+	}
+
+	name, _ := cmd.Flags().GetString("name")
+	if name == "" || name == identity.Name {
+		return identity, nil
+	}
+	if err := config.ValidateIdentityName(name); err != nil {
+		return nil, err
+	}
+	identity.Name = name
+	return identity, identity.Save()
+}
@@ -4,8 +4,6 @@ import (
 	"fmt"
 	"kubconfig-cli/config"
 
-	"github.com/aws/aws-sdk-go/aws"
-	"github.com/aws/aws-sdk-go/service/s3"
 	"github.com/spf13/cobra"
 )
 
@@ -19,24 +17,16 @@ var ListCmd = &cobra.Command{
 			return
 		}
 
-		sess, err := config.CreateS3Session(cfg)
-		if err != nil {
-			fmt.Printf("Error creating AWS session: %v\n", err)
-			return
-		}
-		svc := s3.New(sess)
-
-		result, err := svc.ListObjectsV2(&s3.ListObjectsV2Input{
-			Bucket: aws.String(cfg.S3Bucket),
-		})
+		// Listing also refreshes the catalog used for shell completion
+		catalog, err := config.RefreshCatalog(cfg)
 		if err != nil {
 			fmt.Println("Error listing files:", err)
 			return
 		}
 
 		fmt.Println("Available kubeconfigs:")
-		for _, item := range result.Contents {
-			fmt.Println("-", *item.Key)
+		for _, name := range catalog.Configs {
+			fmt.Println("-", name)
 		}
 	},
 }
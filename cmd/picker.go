@@ -0,0 +1,329 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"kubconfig-cli/config"
+	"os"
+	"os/exec"
+	"sort"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// pickerHeight is the number of entries the picker shows at once
+const pickerHeight = 10
+
+// errPickerCancelled is returned when the picker is left without a choice
+var errPickerCancelled = errors.New("no kubeconfig selected")
+
+// pickerEntry is one kubeconfig offered by the picker
+type pickerEntry struct {
+	Name     string
+	Tags     string
+	LastUsed time.Time
+	Active   *config.Session
+}
+
+// label is the text the query is matched against
+func (e pickerEntry) label() string {
+	return strings.TrimSpace(e.Name + " " + e.Tags)
+}
+
+// pickKubeconfig lets the user choose a kubeconfig from the catalog with a
+// fuzzy finder drawn on stderr, so it also works under --shell-eval
+func pickKubeconfig(cfg config.Config) (string, error) {
+	if !isInteractive() || !isTerminal(os.Stderr) {
+		return "", fmt.Errorf("a kubeconfig name is required when not running in a terminal")
+	}
+
+	catalog, err := config.LoadCatalog()
+	if err != nil || catalog.Stale() {
+		if refreshed, err := config.RefreshCatalog(cfg); err == nil {
+			catalog = refreshed
+		} else if catalog == nil || len(catalog.Configs) == 0 {
+			return "", fmt.Errorf("error listing kubeconfigs: %v", err)
+		}
+	}
+	if len(catalog.Configs) == 0 {
+		return "", fmt.Errorf("no kubeconfigs found in bucket %s", cfg.S3Bucket)
+	}
+
+	entries := pickerEntries(catalog)
+	return runPicker(entries)
+}
+
+// pickerEntries combines the catalog with the local sessions and audit
+// trail, listing active and recently used kubeconfigs first
+func pickerEntries(catalog *config.Catalog) []pickerEntry {
+	active := make(map[string]*config.Session)
+	if registry, err := config.LoadSessionRegistry(); err == nil {
+		for _, session := range registry.Sessions {
+			if !session.Expired() && session.ExpiresAt.After(activeExpiry(active[session.Config])) {
+				active[session.Config] = session
+			}
+		}
+	}
+
+	lastUsed := make(map[string]time.Time)
+	if events, err := config.ReadAuditLog(config.AuditLogFile); err == nil {
+		for _, event := range events {
+			if event.Event == config.AuditActivate && event.Result == config.ResultSuccess && event.Time.After(lastUsed[event.Config]) {
+				lastUsed[event.Config] = event.Time
+			}
+		}
+	}
+
+	entries := make([]pickerEntry, 0, len(catalog.Configs))
+	for _, name := range catalog.Configs {
+		var tags []string
+		for key, value := range catalog.Tags[name] {
+			tags = append(tags, key+"="+value)
+		}
+		sort.Strings(tags)
+		entries = append(entries, pickerEntry{
+			Name:     name,
+			Tags:     strings.Join(tags, " "),
+			LastUsed: lastUsed[name],
+			Active:   active[name],
+		})
+	}
+
+	sort.SliceStable(entries, func(i, j int) bool {
+		if (entries[i].Active != nil) != (entries[j].Active != nil) {
+			return entries[i].Active != nil
+		}
+		return entries[i].LastUsed.After(entries[j].LastUsed)
+	})
+	return entries
+}
+
+func activeExpiry(session *config.Session) time.Time {
+	if session == nil {
+		return time.Time{}
+	}
+	return session.ExpiresAt
+}
+
+// fuzzyScore matches the query as a case-insensitive subsequence of text.
+// Consecutive characters and matches at word starts score higher; -1 means
+// no match.
+func fuzzyScore(text, query string) int {
+	if query == "" {
+		return 0
+	}
+	runes := []rune(strings.ToLower(text))
+	score, streak, pos := 0, 0, 0
+	for _, q := range strings.ToLower(query) {
+		found := false
+		for ; pos < len(runes); pos++ {
+			if runes[pos] != q {
+				streak = 0
+				continue
+			}
+			streak++
+			score += streak
+			if pos == 0 || !unicode.IsLetter(runes[pos-1]) && !unicode.IsDigit(runes[pos-1]) {
+				score += 3
+			}
+			pos++
+			found = true
+			break
+		}
+		if !found {
+			return -1
+		}
+	}
+	return score
+}
+
+// filterEntries returns the entries matching the query, best match first
+func filterEntries(entries []pickerEntry, query string) []pickerEntry {
+	type match struct {
+		entry pickerEntry
+		score int
+	}
+	var matches []match
+	for _, entry := range entries {
+		if score := fuzzyScore(entry.label(), query); score >= 0 {
+			matches = append(matches, match{entry, score})
+		}
+	}
+	sort.SliceStable(matches, func(i, j int) bool {
+		return matches[i].score > matches[j].score
+	})
+
+	filtered := make([]pickerEntry, len(matches))
+	for i, m := range matches {
+		filtered[i] = m.entry
+	}
+	return filtered
+}
+
+// runPicker shows the entries and reads keys until one is chosen. The
+// terminal is put into raw mode with stty, like the rest of the tool
+// shells out instead of linking terminal libraries.
+func runPicker(entries []pickerEntry) (string, error) {
+	saved, err := stty("-g")
+	if err != nil {
+		return "", fmt.Errorf("error reading terminal settings: %v", err)
+	}
+	if _, err := stty("raw", "-echo"); err != nil {
+		return "", fmt.Errorf("error setting up terminal: %v", err)
+	}
+	defer func() {
+		stty(strings.TrimSpace(saved))
+		fmt.Fprint(os.Stderr, "\r\033[J\033[?25h")
+	}()
+
+	width := 80
+	var rows, cols int
+	if size, err := stty("size"); err == nil {
+		if _, err := fmt.Sscanf(size, "%d %d", &rows, &cols); err == nil && cols > 0 {
+			width = cols
+		}
+	}
+
+	query := []rune{}
+	selected, offset := 0, 0
+	matches := entries
+	buf := make([]byte, 64)
+	for {
+		if selected >= len(matches) {
+			selected = len(matches) - 1
+		}
+		if selected < 0 {
+			selected = 0
+		}
+		if selected < offset {
+			offset = selected
+		}
+		if selected >= offset+pickerHeight {
+			offset = selected - pickerHeight + 1
+		}
+		renderPicker(matches, string(query), selected, offset, len(entries), width)
+
+		n, err := os.Stdin.Read(buf)
+		if err != nil {
+			return "", errPickerCancelled
+		}
+		input := buf[:n]
+		changed := false
+		switch {
+		case string(input) == "\033[A", string(input) == "\033OA", input[0] == 16: // up, ctrl-p
+			selected--
+		case string(input) == "\033[B", string(input) == "\033OB", input[0] == 14, input[0] == '\t': // down, ctrl-n
+			selected++
+		case input[0] == '\r', input[0] == '\n':
+			if len(matches) > 0 {
+				return matches[selected].Name, nil
+			}
+		case input[0] == 3, input[0] == 4, string(input) == "\033": // ctrl-c, ctrl-d, esc
+			return "", errPickerCancelled
+		case input[0] == 127, input[0] == 8: // backspace
+			if len(query) > 0 {
+				query = query[:len(query)-1]
+				changed = true
+			}
+		case input[0] == 21: // ctrl-u
+			query, changed = query[:0], true
+		case input[0] >= ' ':
+			for _, r := range string(input) {
+				if unicode.IsPrint(r) {
+					query, changed = append(query, r), true
+				}
+			}
+		}
+		if changed {
+			matches = filterEntries(entries, string(query))
+			selected, offset = 0, 0
+		}
+	}
+}
+
+// renderPicker draws the query line and the visible entries below it, then
+// moves the cursor back to the end of the query
+func renderPicker(matches []pickerEntry, query string, selected, offset, total, width int) {
+	var out strings.Builder
+	out.WriteString("\r\033[J\033[?25l")
+	out.WriteString(truncate(fmt.Sprintf("kubeconfig> %s", query), width))
+
+	lines := 0
+	nameWidth := 0
+	for _, entry := range matches {
+		if len(entry.Name) > nameWidth {
+			nameWidth = len(entry.Name)
+		}
+	}
+	for i := offset; i < len(matches) && i < offset+pickerHeight; i++ {
+		entry := matches[i]
+		lastUsed := "never used"
+		if !entry.LastUsed.IsZero() {
+			lastUsed = "used " + age(time.Since(entry.LastUsed)) + " ago"
+		}
+		state := ""
+		if entry.Active != nil {
+			state = fmt.Sprintf("  active, %s left", compactDuration(entry.Active.Remaining()))
+		}
+		marker := "  "
+		if i == selected {
+			marker = "> "
+		}
+		line := truncate(fmt.Sprintf("%s%-*s  %-14s  %s%s", marker, nameWidth, entry.Name, lastUsed, entry.Tags, state), width)
+		if i == selected {
+			line = "\033[7m" + line + "\033[0m"
+		}
+		out.WriteString("\r\n" + line)
+		lines++
+	}
+	out.WriteString("\r\n" + truncate(fmt.Sprintf("  %d/%d", len(matches), total), width))
+	lines++
+
+	fmt.Fprintf(&out, "\033[%dA\r\033[%dC\033[?25h", lines, min(len("kubeconfig> ")+len([]rune(query)), width-1))
+	fmt.Fprint(os.Stderr, out.String())
+}
+
+// age formats how long ago something happened as 42m, 5h or 3d
+func age(d time.Duration) string {
+	switch {
+	case d < time.Hour:
+		return fmt.Sprintf("%dm", int(d.Minutes()))
+	case d < 48*time.Hour:
+		return fmt.Sprintf("%dh", int(d.Hours()))
+	}
+	return fmt.Sprintf("%dd", int(d.Hours()/24))
+}
+
+// truncate shortens a line to the terminal width so it never wraps
+func truncate(line string, width int) string {
+	runes := []rune(line)
+	if width > 1 && len(runes) >= width {
+		return string(runes[:width-1])
+	}
+	return line
+}
+
+// stty runs stty on the controlling terminal
+func stty(args ...string) (string, error) {
+	cmd := exec.Command("stty", args...)
+	cmd.Stdin = os.Stdin
+	out, err := cmd.Output()
+	return string(out), err
+}
+
+// promptDuration asks for the session duration of a picked kubeconfig; an
+// empty answer keeps the policy default
+func promptDuration() time.Duration {
+	for {
+		answer := promptLine("Session duration (e.g. 2h, 30m; empty for the policy default): ")
+		if answer == "" {
+			return 0
+		}
+		duration, err := time.ParseDuration(answer)
+		if err == nil && duration > 0 {
+			return duration
+		}
+		fmt.Printf("Invalid duration %q\n", answer)
+	}
+}
@@ -0,0 +1,125 @@
+package cmd
+
+import (
+	"fmt"
+	"kubconfig-cli/config"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+var PolicyCmd = &cobra.Command{
+	Use:   "policy",
+	Short: "Inspect the access policy stored in the S3 bucket",
+}
+
+var policyCheckCmd = &cobra.Command{
+	Use:               "check [KUBECONFIG_NAME]",
+	Short:             "Dry-run the policy decision for an activation",
+	Args:              cobra.ExactArgs(1),
+	ValidArgsFunction: completeConfigNames,
+	Run: func(cmd *cobra.Command, args []string) {
+		cfg, err := config.LoadConfig()
+		if err != nil {
+			fmt.Printf("Error loading configuration: %v\n", err)
+			os.Exit(1)
+		}
+
+		name, err := config.ResolveConfigName(cfg, args[0])
+		if err != nil {
+			fmt.Printf("Error: %v\n", err)
+			os.Exit(1)
+		}
+
+		req := config.AccessRequest{Config: name}
+		req.User, _ = cmd.Flags().GetString("user")
+		req.Groups, _ = cmd.Flags().GetStringSlice("group")
+		req.Role, _ = cmd.Flags().GetString("role")
+		req.Namespace, _ = cmd.Flags().GetString("namespace")
+		req.Duration, _ = cmd.Flags().GetDuration("duration")
+		req.Reason, _ = cmd.Flags().GetString("reason")
+
+		if at, _ := cmd.Flags().GetString("at"); at != "" {
+			req.Time, err = time.Parse(time.RFC3339, at)
+			if err != nil {
+				fmt.Printf("Error: --at must be an RFC3339 time: %v\n", err)
+				os.Exit(1)
+			}
+		}
+
+		decision, err := evaluatePolicy(cfg, req)
+		if err != nil {
+			fmt.Printf("Error evaluating policy: %v\n", err)
+			os.Exit(1)
+		}
+
+		printDecision(decision)
+		printDecisionNotes(decision)
+		if !decision.Allowed {
+			os.Exit(1)
+		}
+	},
+}
+
+func init() {
+	policyCheckCmd.Flags().String("user", "", "User to check (default current user)")
+	policyCheckCmd.Flags().StringSlice("group", nil, "Additional groups of the user")
+	policyCheckCmd.Flags().String("role", "", "Requested role")
+	policyCheckCmd.Flags().StringP("namespace", "n", "", "Requested namespace")
+	policyCheckCmd.Flags().Duration("duration", 0, "Requested session duration")
+	policyCheckCmd.Flags().String("reason", "", "Reason for the activation")
+	policyCheckCmd.Flags().String("at", "", "Evaluate at this time (RFC3339, default now)")
+	policyCheckCmd.RegisterFlagCompletionFunc("role", completeRoles)
+	PolicyCmd.AddCommand(policyCheckCmd)
+}
+
+// evaluatePolicy loads the bucket policy and the kubeconfig's tags and
+// decides on the request
+func evaluatePolicy(cfg config.Config, req config.AccessRequest) (*config.Decision, error) {
+	policy, err := config.LoadPolicy(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	tags, err := config.GetObjectTags(cfg, req.Config)
+	if err != nil {
+		return nil, fmt.Errorf("error reading tags of %s: %v", req.Config, err)
+	}
+	req.Tags = tags
+
+	if req.User == "" {
+		if req.User, err = config.CurrentUser(); err != nil {
+			return nil, err
+		}
+	}
+
+	return policy.Evaluate(req), nil
+}
+
+func printDecision(decision *config.Decision) {
+	if decision.Allowed {
+		fmt.Printf("✅ Allowed by policy rule %q\n", decision.Rule)
+		fmt.Printf("   Role: %s\n", decision.Role)
+		fmt.Printf("   Duration: %s (maximum %s)\n", decision.Duration, decision.MaxDuration)
+		if decision.RequireReason {
+			fmt.Println("   A reason is required")
+		}
+		if decision.RequireApproval {
+			fmt.Println("   Approval by a second user is required")
+		}
+		return
+	}
+
+	fmt.Printf("❌ Denied by policy rule %q:\n", decision.Rule)
+	for _, denial := range decision.Denials {
+		fmt.Printf("   - %s\n", denial)
+	}
+}
+
+func printDecisionNotes(decision *config.Decision) {
+	if len(decision.Notes) > 0 {
+		fmt.Printf("Note: %s\n", strings.Join(decision.Notes, "; "))
+	}
+}
@@ -0,0 +1,134 @@
+package cmd
+
+import (
+	"bufio"
+	"fmt"
+	"kubconfig-cli/config"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+// Prompt segment formats
+const (
+	promptANSI  = "ansi"
+	promptBash  = "bash"
+	promptZsh   = "zsh"
+	promptTmux  = "tmux"
+	promptPlain = "plain"
+)
+
+var PromptCmd = &cobra.Command{
+	Use:   "prompt",
+	Short: "Print a prompt segment for the active session, e.g. ⎈ prod-eu [admin] 42m",
+	Long: `Print a compact segment describing the active session for PS1, starship or tmux.
+
+The segment is built from the local session registry only, so it is cheap
+enough to run on every prompt. Nothing is printed without an active session.
+KUBCONFIG_SESSION selects a session other than the current one.`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		format, _ := cmd.Flags().GetString("format")
+		warn, _ := cmd.Flags().GetDuration("warn")
+
+		registry, err := config.LoadSessionRegistry()
+		if err != nil {
+			return
+		}
+		session := registry.CurrentSession()
+		if id := os.Getenv(config.SessionEnv); id != "" {
+			session = registry.Get(id)
+		}
+		if session == nil {
+			return
+		}
+
+		fmt.Print(promptSegment(session, format, warn))
+	},
+}
+
+func init() {
+	PromptCmd.Flags().StringP("format", "f", promptANSI, "Output format: ansi (starship), bash, zsh, tmux or plain")
+	PromptCmd.Flags().Duration("warn", 10*time.Minute, "Show the segment in red when less time than this remains")
+}
+
+// promptSegment renders a session as "⎈ name [role] remaining", coloured
+// for the given shell or terminal multiplexer
+func promptSegment(session *config.Session, format string, warn time.Duration) string {
+	name := session.Cluster
+	if name == "" {
+		name = strings.TrimSuffix(session.Config, ".cfg")
+	}
+
+	role := session.Role
+	if role == "" {
+		role = session.AuthMode
+	}
+	if session.RoleNamespace != "" {
+		role += "@" + session.RoleNamespace
+	}
+
+	remaining := session.Remaining()
+	text := fmt.Sprintf("⎈ %s [%s] %s", name, role, compactDuration(remaining))
+
+	color := "green"
+	switch {
+	case remaining == 0:
+		color = "red"
+		text = fmt.Sprintf("⎈ %s [%s] expired", name, role)
+	case remaining < warn:
+		color = "red"
+	}
+
+	switch format {
+	case promptPlain:
+		return text
+	case promptTmux:
+		return fmt.Sprintf("#[fg=%s]%s#[default]", color, text)
+	case promptZsh:
+		return fmt.Sprintf("%%{%%F{%s}%%}%s%%{%%f%%}", color, text)
+	}
+
+	code := "32"
+	if color == "red" {
+		code = "31"
+	}
+	if format == promptBash {
+		// Readline's markers for invisible characters, as \[ \] are not
+		// interpreted in the output of command substitutions
+		return fmt.Sprintf("\001\033[%sm\002%s\001\033[0m\002", code, text)
+	}
+	return fmt.Sprintf("\033[%sm%s\033[0m", code, text)
+}
+
+// compactDuration formats durations as 42m or 1h05m
+func compactDuration(d time.Duration) string {
+	d = d.Round(time.Minute)
+	if d < time.Hour {
+		return fmt.Sprintf("%dm", int(d.Minutes()))
+	}
+	return fmt.Sprintf("%dh%02dm", int(d.Hours()), int(d.Minutes())%60)
+}
+
+// isInteractive reports whether stdin is a terminal
+func isInteractive() bool {
+	return isTerminal(os.Stdin)
+}
+
+// isTerminal reports whether a file is a terminal
+func isTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	if err != nil {
+		return false
+	}
+	return info.Mode()&os.ModeCharDevice != 0
+}
+
+// promptLine asks for a line of input, keeping embedded spaces
+func promptLine(prompt string) string {
+	fmt.Print(prompt)
+	line, _ := bufio.NewReader(os.Stdin).ReadString('\n')
+	return strings.TrimSpace(line)
+}
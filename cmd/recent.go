@@ -0,0 +1,104 @@
+package cmd
+
+import (
+	"fmt"
+	"kubconfig-cli/config"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+var RecentCmd = &cobra.Command{
+	Use:   "recent",
+	Short: "List recently activated kubeconfigs",
+	Long: `List the kubeconfigs you activated most recently with the duration, role and
+namespace of their last session. 'kubconfig activate -' activates the most
+recent one other than the current session's again.`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		history, err := config.LoadHistory()
+		if err != nil {
+			fmt.Printf("Error reading history: %v\n", err)
+			return
+		}
+		if len(history) == 0 {
+			fmt.Println("No kubeconfigs activated yet")
+			return
+		}
+
+		limit, _ := cmd.Flags().GetInt("limit")
+		if limit > 0 && len(history) > limit {
+			history = history[:limit]
+		}
+
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "ACTIVATED\tCONFIG\tDURATION\tROLE\tNAMESPACE")
+		for _, entry := range history {
+			role := entry.Role
+			if role == "" {
+				role = "-"
+			}
+			namespace := entry.Namespace
+			if namespace == "" {
+				namespace = "(cluster-wide)"
+			}
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", entry.Time.Local().Format("2006-01-02 15:04"),
+				entry.Config, entry.Duration, role, namespace)
+		}
+		w.Flush()
+	},
+}
+
+func init() {
+	RecentCmd.Flags().IntP("limit", "l", 10, "Number of kubeconfigs to show (0 for all)")
+}
+
+// usePreviousActivation points opts at the kubeconfig activated before the
+// current session's and reuses its duration, role, namespace, context and
+// authentication unless they were given as flags
+func usePreviousActivation(cmd *cobra.Command, opts *activateOptions) error {
+	history, err := config.LoadHistory()
+	if err != nil {
+		return fmt.Errorf("error reading history: %v", err)
+	}
+
+	current := ""
+	if registry, err := config.LoadSessionRegistry(); err == nil {
+		id := os.Getenv(config.SessionEnv)
+		if id == "" {
+			id = registry.Current
+		}
+		if session := registry.Get(id); session != nil && !session.Expired() {
+			current = session.Config
+		}
+	}
+
+	entry, ok := config.PreviousConfig(history, current)
+	if !ok {
+		return fmt.Errorf("no previously activated kubeconfig to switch back to")
+	}
+
+	opts.Config = entry.Config
+	if !cmd.Flags().Changed("session") {
+		if opts.Duration, err = time.ParseDuration(entry.Duration); err != nil {
+			opts.Duration = 0
+		}
+	}
+	if !cmd.Flags().Changed("role") {
+		opts.Role = entry.Role
+	}
+	if !cmd.Flags().Changed("namespace") {
+		opts.Namespace = entry.Namespace
+	}
+	if !cmd.Flags().Changed("context") {
+		opts.Context = entry.Context
+	}
+	if !cmd.Flags().Changed("auth") && entry.AuthMode != "" {
+		opts.AuthMode = entry.AuthMode
+	}
+
+	fmt.Printf("Switching back to %s (%s)\n", entry.Config, entry.Duration)
+	return nil
+}
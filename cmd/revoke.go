@@ -0,0 +1,79 @@
+package cmd
+
+import (
+	"fmt"
+	"kubconfig-cli/config"
+	"os"
+
+	"github.com/spf13/cobra"
+)
+
+var RevokeCmd = &cobra.Command{
+	Use:               "revoke [SESSION_ID]",
+	Short:             "Revoke a session, e.g. an issued kubeconfig, before it expires",
+	Args:              cobra.ExactArgs(1),
+	ValidArgsFunction: completeSessionIDs,
+	Run: func(cmd *cobra.Command, args []string) {
+		registry, err := config.LoadSessionRegistry()
+		if err != nil {
+			fmt.Printf("Error reading session registry: %v\n", err)
+			return
+		}
+		session := registry.Get(args[0])
+		if session == nil {
+			fmt.Printf("Error: no such session %s\n", args[0])
+			return
+		}
+
+		if err := endSession(session); err != nil {
+			fmt.Printf("Error revoking session %s: %v\n", session.ID, err)
+			return
+		}
+
+		if session.Switchable() {
+			os.Remove(session.Kubeconfig)
+		}
+
+		// The default kubeconfig holds the current session's credentials
+		if registry.Current == session.ID {
+			if err := os.WriteFile(config.KubeConfigFile, []byte(""), 0600); err != nil {
+				fmt.Printf("Warning: Could not clear kubeconfig: %v\n", err)
+			}
+		}
+
+		fmt.Printf("Revoked session %s (%s)\n", session.ID, session.Config)
+	},
+}
+
+// endSession revokes a session, records the deactivation in the audit trail
+// and removes the session from the registry. Sessions that cannot be revoked
+// stay registered so revoking them can be retried.
+func endSession(session *config.Session) error {
+	event := config.NewAuditEvent(config.AuditDeactivate, session)
+	if err := config.RevokeSession(session); err != nil {
+		event.Result = config.ResultFailure
+		event.Error = err.Error()
+		recordAudit(event)
+		return err
+	}
+	recordAudit(event)
+
+	if cfg, err := config.LoadConfig(); err == nil {
+		notifySession(cfg, config.AuditDeactivate, session)
+
+		// The encrypted copy is useless now, but there is no need to keep it
+		if session.SharedWith != "" {
+			if err := config.DeleteObject(cfg, config.ShareObject(session.ID)); err != nil {
+				fmt.Printf("Warning: Could not delete shared kubeconfig: %v\n", err)
+			}
+		}
+	}
+
+	err := config.UpdateSessionRegistry(func(registry *config.SessionRegistry) {
+		registry.Remove(session.ID)
+	})
+	if err != nil {
+		fmt.Printf("Warning: Could not update session registry: %v\n", err)
+	}
+	return nil
+}
@@ -0,0 +1,180 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"kubconfig-cli/config"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+var SessionReportCmd = &cobra.Command{
+	Use:               "session-report [SESSION_ID]",
+	Short:             "Summarise what a session did from Kubernetes API audit logs",
+	Args:              cobra.ExactArgs(1),
+	ValidArgsFunction: completeSessionIDs,
+	Run: func(cmd *cobra.Command, args []string) {
+		session, ended, err := findSession(cmd, args[0])
+		if err != nil {
+			fmt.Printf("Error: %v\n", err)
+			return
+		}
+
+		username, err := config.SessionUsername(session)
+		if err != nil {
+			fmt.Printf("Error: %v\n", err)
+			return
+		}
+
+		auditLog, _ := cmd.Flags().GetString("audit-log")
+		if auditLog == "" {
+			fmt.Println("Error: --audit-log is required (use - to read from stdin)")
+			return
+		}
+		var input io.Reader = os.Stdin
+		if auditLog != "-" {
+			f, err := os.Open(auditLog)
+			if err != nil {
+				fmt.Printf("Error opening audit log: %v\n", err)
+				return
+			}
+			defer f.Close()
+			input = f
+		}
+
+		activity, err := config.AnalyzeKubeAudit(input, username, session.CreatedAt, ended)
+		if err != nil {
+			fmt.Printf("Error reading audit log: %v\n", err)
+			return
+		}
+		activity.SharedServiceAccount = config.SharedServiceAccount(session)
+
+		if output, _ := cmd.Flags().GetString("output"); output == "json" {
+			data, err := json.MarshalIndent(struct {
+				Session  *config.Session         `json:"session"`
+				Activity *config.SessionActivity `json:"activity"`
+			}{session, activity}, "", "  ")
+			if err != nil {
+				fmt.Printf("Error encoding report: %v\n", err)
+				return
+			}
+			fmt.Println(string(data))
+			return
+		}
+
+		printSessionReport(session, activity)
+	},
+}
+
+func init() {
+	SessionReportCmd.Flags().String("audit-log", "", "Kubernetes audit log in JSON lines format (- for stdin)")
+	SessionReportCmd.Flags().StringP("output", "o", "text", "Output format: text or json")
+	SessionReportCmd.Flags().Bool("bucket", false, "Look up sessions in the bucket's audit trail")
+}
+
+// findSession looks a session up in the registry, falling back to the audit
+// trail for sessions that have been deactivated. It also returns when the
+// session ended.
+func findSession(cmd *cobra.Command, id string) (*config.Session, time.Time, error) {
+	registry, err := config.LoadSessionRegistry()
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+	if session := registry.Get(id); session != nil {
+		ended := session.ExpiresAt
+		if now := time.Now(); now.Before(ended) {
+			ended = now
+		}
+		return session, ended, nil
+	}
+
+	var events []*config.AuditEvent
+	if bucket, _ := cmd.Flags().GetBool("bucket"); bucket {
+		cfg, err := config.LoadConfig()
+		if err != nil {
+			return nil, time.Time{}, err
+		}
+		events, err = config.ReadBucketAudit(cfg, time.Time{})
+		if err != nil {
+			return nil, time.Time{}, err
+		}
+	} else if events, err = config.ReadAuditLog(config.AuditLogFile); err != nil {
+		return nil, time.Time{}, err
+	}
+
+	session, ended := config.SessionFromAudit(events, id)
+	if session == nil {
+		return nil, time.Time{}, fmt.Errorf("session %s not found in the registry or audit trail", id)
+	}
+	return session, ended, nil
+}
+
+func printSessionReport(session *config.Session, activity *config.SessionActivity) {
+	fmt.Printf("Session report: %s\n", session.ID)
+	fmt.Printf("  User:            %s\n", session.User)
+	fmt.Printf("  Kubeconfig:      %s\n", session.Config)
+	if session.Cluster != "" {
+		fmt.Printf("  Cluster:         %s (%s)\n", session.Cluster, session.Server)
+	}
+	role := session.Role
+	if session.RoleNamespace != "" {
+		role += " in namespace " + session.RoleNamespace
+	}
+	fmt.Printf("  Role:            %s\n", role)
+	fmt.Printf("  ServiceAccount:  %s\n", activity.Username)
+	fmt.Printf("  Window:          %s - %s\n", activity.From.Local().Format(time.RFC3339), activity.To.Local().Format(time.RFC3339))
+	if session.Reason != "" {
+		fmt.Printf("  Reason:          %s\n", session.Reason)
+	}
+	if session.Ticket != "" {
+		fmt.Printf("  Ticket:          %s\n", session.Ticket)
+	}
+	fmt.Printf("  API requests:    %d\n", activity.Requests)
+	if activity.SharedServiceAccount {
+		fmt.Println("  Warning:         the ServiceAccount was shared with the user's other sessions;")
+		fmt.Println("                   requests of overlapping sessions are included")
+	}
+	if len(activity.SourceIPs) > 0 {
+		fmt.Printf("  Source IPs:      %s\n", strings.Join(activity.SourceIPs, ", "))
+	}
+
+	fmt.Println()
+	if len(activity.Mutations) == 0 {
+		fmt.Println("No mutating requests")
+	} else {
+		fmt.Println("Mutating requests:")
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "  NAMESPACE\tRESOURCE\tVERB\tCOUNT")
+		for _, m := range activity.Mutations {
+			namespace := m.Namespace
+			if namespace == "" {
+				namespace = "(cluster)"
+			}
+			fmt.Fprintf(w, "  %s\t%s\t%s\t%d\n", namespace, m.Resource, m.Verb, m.Count)
+		}
+		w.Flush()
+	}
+
+	fmt.Println()
+	if len(activity.Denied) == 0 {
+		fmt.Println("No denied requests")
+		return
+	}
+	fmt.Println("Denied requests:")
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "  TIME\tVERB\tRESOURCE\tNAMESPACE\tNAME\tCODE")
+	for _, d := range activity.Denied {
+		resource := d.Resource
+		if resource == "" {
+			resource = d.URI
+		}
+		fmt.Fprintf(w, "  %s\t%s\t%s\t%s\t%s\t%d\n",
+			d.Time.Local().Format(time.RFC3339), d.Verb, resource, d.Namespace, d.Name, d.Code)
+	}
+	w.Flush()
+}
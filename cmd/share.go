@@ -0,0 +1,221 @@
+package cmd
+
+import (
+	"fmt"
+	"kubconfig-cli/config"
+	"os"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+var ShareCmd = &cobra.Command{
+	Use:   "share [KUBECONFIG_NAME]",
+	Short: "Share time-limited access with a teammate or customer",
+	Long: `Issue a scoped session kubeconfig, as 'issue' does, and encrypt it to the
+recipient's registered public key (see 'keys register'). The encrypted
+kubeconfig is uploaded under shares/ in the bucket and a download link
+expiring with the session is printed; the recipient runs
+'kubconfig receive <url>'.
+
+Revoke the share early with 'kubconfig revoke <session-id>'.`,
+	Example:           `  kubconfig share prod.cfg --to bob@example.com --duration 4h --role view`,
+	Args:              cobra.ExactArgs(1),
+	ValidArgsFunction: completeConfigNames,
+	Run: func(cmd *cobra.Command, args []string) {
+		to, _ := cmd.Flags().GetString("to")
+		if to == "" {
+			fmt.Println("Error: a recipient is required (e.g., --to bob@example.com)")
+			return
+		}
+
+		opts := activateOptions{Config: args[0], AuthMode: config.AuthServiceAccount, Issue: true}
+		opts.Duration, _ = cmd.Flags().GetDuration("duration")
+		opts.Role, _ = cmd.Flags().GetString("role")
+		opts.RoleSet = cmd.Flags().Changed("role")
+		opts.Namespace, _ = cmd.Flags().GetString("namespace")
+		opts.Context, _ = cmd.Flags().GetString("context")
+		opts.Reason, _ = cmd.Flags().GetString("reason")
+		opts.Ticket, _ = cmd.Flags().GetString("ticket")
+		opts.RequestID, _ = cmd.Flags().GetString("request")
+		opts.Wait, _ = cmd.Flags().GetDuration("wait")
+		if opts.Duration < 0 {
+			fmt.Println("Error: valid duration is required (e.g., --duration 4h)")
+			return
+		}
+
+		cfg, err := config.LoadConfig()
+		if err != nil {
+			fmt.Printf("Error loading configuration: %v\n", err)
+			return
+		}
+		identity, err := config.LoadIdentity()
+		if err != nil {
+			fmt.Printf("Error loading identity: %v\n", err)
+			return
+		}
+
+		// Check the recipient can decrypt before creating any access
+		recipient, err := config.GetPublicIdentity(cfg, to)
+		if err != nil {
+			if config.IsNotFound(err) {
+				fmt.Printf("Error: no key registered for %s; ask them to run 'kubconfig keys register --name %s'\n", to, to)
+			} else {
+				fmt.Printf("Error fetching key of %s: %v\n", to, err)
+			}
+			return
+		}
+		if recipient.EncryptionKey == "" {
+			fmt.Printf("Error: %s has not registered an encryption key; ask them to run 'kubconfig keys register'\n", to)
+			return
+		}
+
+		session, kubeconfig, err := activateSession(cfg, opts)
+		if err != nil {
+			fmt.Printf("Error issuing kubeconfig for %s: %v\n", opts.Config, err)
+			return
+		}
+		session.SharedWith = to
+		session.Kubeconfig = config.ShareObject(session.ID)
+
+		url, err := uploadShare(cfg, session, kubeconfig, identity.Name, recipient)
+
+		event := config.NewAuditEvent(config.AuditIssue, session)
+		event.Details = fmt.Sprintf("shared kubeconfig with %s", to)
+		if err != nil {
+			event.Result = config.ResultFailure
+			event.Error = err.Error()
+		}
+		recordAudit(event)
+
+		if err != nil {
+			fmt.Printf("Error sharing kubeconfig: %v\n", err)
+			if err := config.RevokeSession(session); err != nil {
+				fmt.Printf("Warning: Could not revoke session %s: %v\n", session.ID, err)
+			}
+			return
+		}
+
+		err = config.UpdateSessionRegistry(func(registry *config.SessionRegistry) {
+			registry.Add(session)
+		})
+		if err != nil {
+			fmt.Printf("Warning: Could not record session: %v\n", err)
+		}
+
+		fmt.Printf("Shared '%s' with %s as session %s (expires at %s)\n",
+			session.Config, to, session.ID, session.ExpiresAt.Format(time.RFC3339))
+		fmt.Printf("Send them this command; the link only works with their key:\n\n")
+		fmt.Printf("  kubconfig receive '%s'\n\n", url)
+		fmt.Printf("Revoke it early with: kubconfig revoke %s\n", session.ID)
+	},
+}
+
+var ReceiveCmd = &cobra.Command{
+	Use:   "receive [URL|FILE]",
+	Short: "Decrypt and activate a kubeconfig shared with you",
+	Long: `Download a kubeconfig shared with 'kubconfig share', decrypt it with your
+local identity and activate it. No bucket access is needed. With --output
+the kubeconfig is written to a file instead.`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		identity, err := config.LoadIdentity()
+		if err != nil {
+			fmt.Printf("Error loading identity: %v\n", err)
+			return
+		}
+
+		data, err := config.FetchShare(args[0])
+		if err != nil {
+			fmt.Printf("Error downloading shared kubeconfig: %v\n", err)
+			return
+		}
+		share, err := config.OpenShare(identity, data)
+		if err != nil {
+			fmt.Printf("Error: %v\n", err)
+			return
+		}
+
+		session := &config.Session{
+			ID:            share.SessionID,
+			Config:        share.Config,
+			Cluster:       share.Cluster,
+			Server:        share.Server,
+			User:          identity.Name,
+			AuthMode:      config.AuthServiceAccount,
+			Role:          share.Role,
+			RoleNamespace: share.Namespace,
+			SharedBy:      share.SharedBy,
+			CreatedAt:     time.Now(),
+			ExpiresAt:     share.ExpiresAt,
+		}
+
+		output, _ := cmd.Flags().GetString("output")
+		if output != "" {
+			session.Kubeconfig = output
+			err = os.WriteFile(output, share.Kubeconfig, 0600)
+		} else {
+			err = saveCurrentKubeconfig(session, share.Kubeconfig)
+		}
+		if err != nil {
+			fmt.Printf("Error saving kubeconfig: %v\n", err)
+			return
+		}
+
+		event := config.NewAuditEvent(config.AuditActivate, session)
+		event.Details = fmt.Sprintf("received from %s", share.SharedBy)
+		recordAudit(event)
+
+		if output != "" {
+			fmt.Printf("Saved '%s' shared by %s to %s (expires at %s)\n",
+				share.Config, share.SharedBy, output, share.ExpiresAt.Format(time.RFC3339))
+			return
+		}
+		if err := recordSession(session); err != nil {
+			fmt.Printf("Warning: Could not record session: %v\n", err)
+		}
+		fmt.Printf("Successfully activated '%s' shared by %s (session expires at %s)\n",
+			share.Config, share.SharedBy, share.ExpiresAt.Format(time.RFC3339))
+	},
+}
+
+func init() {
+	ShareCmd.Flags().String("to", "", "Name of the recipient's registered key, e.g. bob@example.com")
+	ShareCmd.Flags().Duration("duration", 0, "Lifetime of the shared access (e.g., 4h; default from policy)")
+	ShareCmd.Flags().String("role", "", "ClusterRole to grant (default from policy, otherwise cluster-admin)")
+	ShareCmd.Flags().StringP("namespace", "n", "", "Only grant the role within this namespace")
+	ShareCmd.Flags().String("context", "", "Context of the kubeconfig to activate (default: its current context)")
+	ShareCmd.Flags().String("reason", "", "Reason for sharing access")
+	ShareCmd.Flags().String("ticket", "", "Ticket reference (default: first ticket ID found in the reason)")
+	ShareCmd.Flags().String("request", "", "Resume waiting for an earlier approval request")
+	ShareCmd.Flags().Duration("wait", 30*time.Minute, "How long to wait for approval")
+	ShareCmd.RegisterFlagCompletionFunc("role", completeRoles)
+	ShareCmd.RegisterFlagCompletionFunc("context", completeContexts)
+	ReceiveCmd.Flags().StringP("output", "o", "", "Write the kubeconfig to this file instead of activating it")
+}
+
+// uploadShare encrypts a session kubeconfig to the recipient, uploads it
+// under shares/ and returns a download link expiring with the session
+func uploadShare(cfg config.Config, session *config.Session, kubeconfig []byte, sharedBy string, recipient *config.PublicIdentity) (string, error) {
+	sealed, err := config.SealShare(recipient, &config.SharedKubeconfig{
+		SessionID:  session.ID,
+		Config:     session.Config,
+		Cluster:    session.Cluster,
+		Server:     session.Server,
+		Role:       session.Role,
+		Namespace:  session.RoleNamespace,
+		SharedBy:   sharedBy,
+		SharedWith: recipient.Name,
+		ExpiresAt:  session.ExpiresAt,
+		Kubeconfig: kubeconfig,
+	})
+	if err != nil {
+		return "", err
+	}
+
+	key := config.ShareObject(session.ID)
+	if err := config.PutObject(cfg, key, sealed); err != nil {
+		return "", fmt.Errorf("error uploading %s: %v", key, err)
+	}
+	return config.PresignObject(cfg, key, time.Until(session.ExpiresAt))
+}
@@ -2,67 +2,310 @@ package cmd
 
 import (
 	"fmt"
+	"kubconfig-cli/config"
 	"os"
+	"os/exec"
+	"os/signal"
 	"path/filepath"
 	"strings"
+	"syscall"
+	"time"
 
 	"github.com/spf13/cobra"
 )
 
 const shellIntegrationMarker = "# Kubconfig shell integration"
-const shellIntegrationScript = `
-kubconfig() {
-	if [ "$1" = "activate" ]; then
-		eval "$(command kubconfig activate "$2" --session "$3" --shell-eval)"
-	elif [ "$1" = "deactivate" ]; then
-		eval "$(command kubconfig deactivate --shell-eval)"
-	else
-		command kubconfig "$@"
-	fi
-}
-`
+
+// shellIntegrationScripts load the hook of 'kubconfig shell-init'
+var shellIntegrationScripts = map[string]string{
+	".bashrc": `eval "$(command kubconfig shell-init bash)"`,
+	".zshrc":  `eval "$(command kubconfig shell-init zsh)"`,
+}
+
+const shellPromptMarker = "# Kubconfig prompt"
+
+// shellPromptScripts prefix the prompt with the session segment of
+// 'kubconfig prompt'
+var shellPromptScripts = map[string]string{
+	".bashrc": `__kubconfig_ps1() { local s; s="$(command kubconfig prompt --format bash)"; [ -n "$s" ] && printf '%s ' "$s"; }
+PS1='$(__kubconfig_ps1)'"$PS1"`,
+	".zshrc": `__kubconfig_ps1() { local s; s="$(command kubconfig prompt --format zsh)"; [ -n "$s" ] && printf '%s ' "$s"; }
+setopt PROMPT_SUBST
+PROMPT='$(__kubconfig_ps1)'"$PROMPT"`,
+}
 
 var ShellCmd = &cobra.Command{
-	Use:   "shell [install|uninstall]",
-	Short: "Manage shell integration",
-	Args:  cobra.ExactArgs(1),
+	Use:   "shell [KUBECONFIG_NAME]",
+	Short: "Start a subshell bound to a session, or manage shell integration",
+	Long: `Start your $SHELL with KUBECONFIG pointing at a private session kubeconfig
+and the session in the prompt. You are warned before the session expires and
+the subshell is closed when it does (--on-expiry warn keeps it open). Leaving
+the subshell revokes the session, so closing a terminal leaves no
+ServiceAccounts behind. Other sessions on the same cluster are not affected.
+
+'shell install' and 'shell uninstall' manage the rc file integration.`,
+	Example:           `  kubconfig shell prod.cfg --duration 1h`,
+	Args:              cobra.ExactArgs(1),
+	ValidArgsFunction: completeConfigNames,
 	Run: func(cmd *cobra.Command, args []string) {
-		action := args[0]
-		shells := []string{
-			filepath.Join(os.Getenv("HOME"), ".bashrc"),
-			filepath.Join(os.Getenv("HOME"), ".zshrc"),
+		onExpiry, _ := cmd.Flags().GetString("on-expiry")
+		if onExpiry != "exit" && onExpiry != "warn" {
+			fmt.Println("Error: --on-expiry must be exit or warn")
+			return
 		}
+		warn, _ := cmd.Flags().GetDuration("warn")
 
-		switch action {
-		case "install":
-			for _, shellRc := range shells {
-				if err := installShellIntegration(shellRc); err != nil {
-					fmt.Printf("Error installing to %s: %v\n", shellRc, err)
-				} else {
-					fmt.Printf("Installed shell integration to %s\n", shellRc)
-				}
+		opts := activateOptions{Config: args[0]}
+		opts.Duration, _ = cmd.Flags().GetDuration("duration")
+		opts.Role, _ = cmd.Flags().GetString("role")
+		opts.RoleSet = cmd.Flags().Changed("role")
+		opts.Namespace, _ = cmd.Flags().GetString("namespace")
+		opts.Context, _ = cmd.Flags().GetString("context")
+		opts.Reason, _ = cmd.Flags().GetString("reason")
+		opts.Ticket, _ = cmd.Flags().GetString("ticket")
+		opts.AuthMode, _ = cmd.Flags().GetString("auth")
+		opts.Wait, _ = cmd.Flags().GetDuration("wait")
+		if opts.Duration < 0 {
+			fmt.Println("Error: valid duration is required (e.g., --duration 1h)")
+			return
+		}
+
+		cfg, err := config.LoadConfig()
+		if err != nil {
+			fmt.Printf("Error loading configuration: %v\n", err)
+			return
+		}
+
+		signals := catchSignals()
+		session, err := startGuardedSession(cfg, opts, signals)
+		if err != nil {
+			fmt.Printf("Error activating %s: %v\n", opts.Config, err)
+			os.Exit(1)
+		}
+
+		os.Exit(runSubshell(session, onExpiry, warn, signals))
+	},
+}
+
+// runSubshell runs $SHELL bound to a private session and revokes the
+// session however the shell ends, returning its exit code
+func runSubshell(session *config.Session, onExpiry string, warn time.Duration, signals chan os.Signal) int {
+	// Signals stay caught, and are dropped, until the session is revoked, so
+	// a Ctrl+C after the shell exits does not interrupt the revocation
+	defer func() {
+		closePrivateSession(session)
+		signal.Stop(signals)
+		fmt.Printf("Session %s ended\n", session.ID)
+	}()
+
+	rcDir, err := os.MkdirTemp("", "kubconfig-shell-")
+	if err != nil {
+		fmt.Printf("Error creating shell startup files: %v\n", err)
+		return 1
+	}
+	defer os.RemoveAll(rcDir)
+
+	child, err := subshellCommand(rcDir, session)
+	if err != nil {
+		fmt.Printf("Error preparing shell: %v\n", err)
+		return 1
+	}
+	child.Stdin, child.Stdout, child.Stderr = os.Stdin, os.Stdout, os.Stderr
+
+	fmt.Printf("Starting %s for '%s' (session %s expires at %s); exit to revoke it\n",
+		filepath.Base(child.Path), session.Config, session.ID, session.ExpiresAt.Local().Format(time.RFC3339))
+
+	if remaining := session.Remaining(); remaining > warn {
+		warnTimer := time.AfterFunc(remaining-warn, func() {
+			fmt.Fprintf(os.Stderr, "\n⚠️  kubconfig session %s expires in %s\n", session.ID, session.Remaining().Round(time.Minute))
+		})
+		defer warnTimer.Stop()
+	}
+	expiryTimer := time.AfterFunc(session.Remaining(), func() {
+		if onExpiry == "warn" {
+			fmt.Fprintf(os.Stderr, "\n⚠️  kubconfig session %s has expired; exit the shell to clean up\n", session.ID)
+			return
+		}
+		fmt.Fprintf(os.Stderr, "\n⚠️  kubconfig session %s has expired; closing the shell\n", session.ID)
+		if child.Process != nil {
+			child.Process.Signal(syscall.SIGHUP)
+		}
+	})
+	defer expiryTimer.Stop()
+
+	code, err := runForwardingSignals(child, signals)
+	if err != nil {
+		fmt.Printf("Error running shell: %v\n", err)
+	}
+	return code
+}
+
+var shellInstallCmd = &cobra.Command{
+	Use:   "install",
+	Short: "Add the shell integration to ~/.bashrc and ~/.zshrc",
+	Args:  cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		withPrompt, _ := cmd.Flags().GetBool("prompt")
+		if !cmd.Flags().Changed("prompt") && isInteractive() {
+			answer := promptLine("Show the active session and time remaining in your prompt? (y/N): ")
+			withPrompt = strings.EqualFold(answer, "y") || strings.EqualFold(answer, "yes")
+		}
+
+		for _, shellRc := range shellRcFiles() {
+			if err := installShellIntegration(shellRc); err != nil {
+				fmt.Printf("Error installing to %s: %v\n", shellRc, err)
+				continue
 			}
-			fmt.Println("\nPlease restart your shell or run:")
-			fmt.Println("source ~/.bashrc  # for bash")
-			fmt.Println("source ~/.zshrc   # for zsh")
-
-		case "uninstall":
-			for _, shellRc := range shells {
-				if err := removeShellIntegration(shellRc); err != nil {
-					fmt.Printf("Error removing from %s: %v\n", shellRc, err)
+			fmt.Printf("Installed shell integration to %s\n", shellRc)
+
+			if withPrompt {
+				if err := installPromptIntegration(shellRc); err != nil {
+					fmt.Printf("Error installing prompt to %s: %v\n", shellRc, err)
 				} else {
-					fmt.Printf("Removed shell integration from %s\n", shellRc)
+					fmt.Printf("Installed prompt segment to %s\n", shellRc)
 				}
 			}
-		default:
-			fmt.Println("Invalid action. Use 'install' or 'uninstall'")
 		}
+		fmt.Println("\nPlease restart your shell or run:")
+		fmt.Println("source ~/.bashrc  # for bash")
+		fmt.Println("source ~/.zshrc   # for zsh")
 	},
 }
 
+var shellUninstallCmd = &cobra.Command{
+	Use:   "uninstall",
+	Short: "Remove the shell integration from ~/.bashrc and ~/.zshrc",
+	Args:  cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		for _, shellRc := range shellRcFiles() {
+			if err := removeShellIntegration(shellRc); err != nil {
+				fmt.Printf("Error removing from %s: %v\n", shellRc, err)
+			} else {
+				fmt.Printf("Removed shell integration from %s\n", shellRc)
+			}
+		}
+	},
+}
+
+func init() {
+	ShellCmd.Flags().Duration("duration", 0, "Session duration (e.g., 1h; default from policy)")
+	ShellCmd.Flags().String("role", "", "ClusterRole to grant (default from policy, otherwise cluster-admin)")
+	ShellCmd.Flags().StringP("namespace", "n", "", "Only grant the role within this namespace")
+	ShellCmd.Flags().String("context", "", "Context of the kubeconfig to activate (default: its current context)")
+	ShellCmd.Flags().String("reason", "", "Reason for the activation")
+	ShellCmd.Flags().String("ticket", "", "Ticket reference (default: first ticket ID found in the reason)")
+	ShellCmd.Flags().String("auth", config.AuthAuto, "Authentication mode: auto, serviceaccount, impersonate, eks or exec")
+	ShellCmd.Flags().Duration("wait", 30*time.Minute, "How long to wait for approval")
+	ShellCmd.Flags().String("on-expiry", "exit", "What to do when the session expires: exit or warn")
+	ShellCmd.Flags().Duration("warn", 5*time.Minute, "Warn this long before the session expires")
+
+	ShellCmd.RegisterFlagCompletionFunc("role", completeRoles)
+	ShellCmd.RegisterFlagCompletionFunc("context", completeContexts)
+
+	shellInstallCmd.Flags().Bool("prompt", false, "Also show the active session in the shell prompt (asked when interactive)")
+	ShellCmd.AddCommand(shellInstallCmd)
+	ShellCmd.AddCommand(shellUninstallCmd)
+}
+
+func shellRcFiles() []string {
+	return []string{
+		filepath.Join(os.Getenv("HOME"), ".bashrc"),
+		filepath.Join(os.Getenv("HOME"), ".zshrc"),
+	}
+}
+
+// subshellCommand returns the user's shell bound to a session, set up to
+// show the session in its prompt after reading the usual startup files.
+// Startup files written for bash and zsh are placed in rcDir.
+func subshellCommand(rcDir string, session *config.Session) (*exec.Cmd, error) {
+	shell := os.Getenv("SHELL")
+	if shell == "" {
+		shell = "/bin/sh"
+	}
+
+	home := os.Getenv("HOME")
+	write := func(name, content string) error {
+		return os.WriteFile(filepath.Join(rcDir, name), []byte(content), 0600)
+	}
+
+	switch filepath.Base(shell) {
+	case "bash":
+		rc := fmt.Sprintf("[ -f %[1]q ] && . %[1]q\n%s\n", filepath.Join(home, ".bashrc"), subshellPrompt(".bashrc"))
+		if err := write("bashrc", rc); err != nil {
+			return nil, err
+		}
+		cmd := exec.Command(shell, "--rcfile", filepath.Join(rcDir, "bashrc"), "-i")
+		cmd.Env = sessionEnviron(session)
+		return cmd, nil
+
+	case "zsh":
+		// zsh reads its startup files from ZDOTDIR; hand back to the
+		// user's own before the prompt is set up
+		zdotdir := os.Getenv("ZDOTDIR")
+		if zdotdir == "" {
+			zdotdir = home
+		}
+		env := fmt.Sprintf("[ -f %[1]q ] && . %[1]q\n", filepath.Join(zdotdir, ".zshenv"))
+		rc := fmt.Sprintf("ZDOTDIR=%q\n[ -f %[2]q ] && . %[2]q\n%s\n", zdotdir, filepath.Join(zdotdir, ".zshrc"), subshellPrompt(".zshrc"))
+		if err := write(".zshenv", env); err != nil {
+			return nil, err
+		}
+		if err := write(".zshrc", rc); err != nil {
+			return nil, err
+		}
+		cmd := exec.Command(shell, "-i")
+		cmd.Env = append(sessionEnviron(session), "ZDOTDIR="+rcDir)
+		return cmd, nil
+
+	case "fish":
+		cmd := exec.Command(shell, "-i", "-C", `functions -c fish_prompt __kubconfig_fish_prompt
+function fish_prompt
+    set -l s (command kubconfig prompt --format ansi)
+    test -n "$s"; and printf '%s ' $s
+    __kubconfig_fish_prompt
+end`)
+		cmd.Env = sessionEnviron(session)
+		return cmd, nil
+	}
+
+	// Other shells read PS1 from the environment
+	cmd := exec.Command(shell, "-i")
+	cmd.Env = append(sessionEnviron(session), fmt.Sprintf("PS1=⎈ %s $ ", strings.TrimSuffix(session.Config, ".cfg")))
+	return cmd, nil
+}
+
+// subshellPrompt returns the prompt script for a shell unless the user's rc
+// file has already installed it
+func subshellPrompt(rcFile string) string {
+	return fmt.Sprintf("if ! typeset -f __kubconfig_ps1 >/dev/null 2>&1; then\n%s\nfi", shellPromptScripts[rcFile])
+}
+
+// installShellIntegration adds the hook to an rc file, replacing the
+// wrapper function written by earlier versions
 func installShellIntegration(rcFile string) error {
+	script, ok := shellIntegrationScripts[filepath.Base(rcFile)]
+	if !ok {
+		return fmt.Errorf("unsupported shell")
+	}
+	if err := removeShellBlock(rcFile, shellIntegrationMarker); err != nil {
+		return err
+	}
+	return appendShellBlock(rcFile, shellIntegrationMarker, script)
+}
+
+func installPromptIntegration(rcFile string) error {
+	script, ok := shellPromptScripts[filepath.Base(rcFile)]
+	if !ok {
+		return fmt.Errorf("unsupported shell")
+	}
+	return appendShellBlock(rcFile, shellPromptMarker, script)
+}
+
+// appendShellBlock adds a marked script to a shell rc file once. Blocks end
+// at the first blank line, so scripts must not contain any.
+func appendShellBlock(rcFile, marker, script string) error {
 	// Check if already installed
-	if isIntegrationInstalled(rcFile) {
+	if isBlockInstalled(rcFile, marker) {
 		return nil
 	}
 
@@ -73,12 +316,21 @@ func installShellIntegration(rcFile string) error {
 	defer f.Close()
 
 	// Add integration script
-	_, err = f.WriteString(fmt.Sprintf("\n%s\n%s\n", shellIntegrationMarker, shellIntegrationScript))
+	_, err = f.WriteString(fmt.Sprintf("\n%s\n%s\n", marker, strings.TrimSpace(script)))
 	return err
 }
 
 func removeShellIntegration(rcFile string) error {
-	if !isIntegrationInstalled(rcFile) {
+	for _, marker := range []string{shellPromptMarker, shellIntegrationMarker} {
+		if err := removeShellBlock(rcFile, marker); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func removeShellBlock(rcFile, marker string) error {
+	if !isBlockInstalled(rcFile, marker) {
 		return nil
 	}
 
@@ -90,18 +342,23 @@ func removeShellIntegration(rcFile string) error {
 
 	lines := strings.Split(string(content), "\n")
 	var newLines []string
-	removing := false
+	removing, started := false, false
 
-	// Remove integration block
+	// Remove integration block; earlier versions left a blank line between
+	// the marker and the script
 	for _, line := range lines {
-		if strings.TrimSpace(line) == shellIntegrationMarker {
-			removing = true
+		if strings.TrimSpace(line) == marker {
+			removing, started = true, false
 			continue
 		}
 		if removing && strings.TrimSpace(line) == "" {
+			if !started {
+				continue
+			}
 			removing = false
 			continue
 		}
+		started = started || removing
 		if !removing {
 			newLines = append(newLines, line)
 		}
@@ -111,10 +368,10 @@ func removeShellIntegration(rcFile string) error {
 	return os.WriteFile(rcFile, []byte(strings.Join(newLines, "\n")), 0644)
 }
 
-func isIntegrationInstalled(rcFile string) bool {
+func isBlockInstalled(rcFile, marker string) bool {
 	content, err := os.ReadFile(rcFile)
 	if err != nil {
 		return false
 	}
-	return strings.Contains(string(content), shellIntegrationMarker)
+	return strings.Contains(string(content), marker)
 }
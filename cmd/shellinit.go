@@ -0,0 +1,144 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+// shellHooks wrap kubconfig so activate and deactivate change the
+// environment of the calling shell. SHELL is replaced by the shell name.
+var shellHooks = map[string]string{
+	"bash": posixShellHook,
+	"zsh":  posixShellHook,
+	"fish": `function kubconfig
+    if contains -- -h $argv; or contains -- --help $argv
+        command kubconfig $argv
+        return
+    end
+    switch "$argv[1]"
+        case activate
+            set -l code (command kubconfig activate $argv[2..-1] --shell-eval=fish); or return
+            printf '%s\n' $code | source
+            set -g __kubconfig_session $KUBCONFIG_SESSION
+        case deactivate
+            command kubconfig deactivate $argv[2..-1] --shell-eval=fish | source
+            set -e __kubconfig_session
+        case '*'
+            command kubconfig $argv
+    end
+end
+`,
+}
+
+const posixShellHook = `kubconfig() {
+	case " $* " in
+	*" -h "* | *" --help "*)
+		command kubconfig "$@"
+		return
+		;;
+	esac
+	case "$1" in
+	activate)
+		shift
+		local __kubconfig_eval
+		__kubconfig_eval="$(command kubconfig activate "$@" --shell-eval=SHELL)" || return
+		eval "$__kubconfig_eval"
+		__kubconfig_session="$KUBCONFIG_SESSION"
+		;;
+	deactivate)
+		shift
+		eval "$(command kubconfig deactivate "$@" --shell-eval=SHELL)"
+		__kubconfig_session=
+		;;
+	*)
+		command kubconfig "$@"
+		;;
+	esac
+}
+`
+
+// shellExitHooks deactivate the session activated in a shell when it exits
+var shellExitHooks = map[string]string{
+	"bash": `__kubconfig_exit() {
+	[ -n "$__kubconfig_session" ] && command kubconfig deactivate --session "$__kubconfig_session" >/dev/null 2>&1
+}
+trap __kubconfig_exit EXIT
+`,
+	"zsh": `__kubconfig_exit() {
+	[ -n "$__kubconfig_session" ] && command kubconfig deactivate --session "$__kubconfig_session" >/dev/null 2>&1
+}
+autoload -Uz add-zsh-hook
+add-zsh-hook zshexit __kubconfig_exit
+`,
+	"fish": `function __kubconfig_exit --on-event fish_exit
+    test -n "$__kubconfig_session"; and command kubconfig deactivate --session $__kubconfig_session >/dev/null 2>&1
+end
+`,
+}
+
+var ShellInitCmd = &cobra.Command{
+	Use:   "shell-init [bash|zsh|fish]",
+	Short: "Print the shell hook that lets activate and deactivate set KUBECONFIG",
+	Long: `Print a hook defining a kubconfig shell function. With it, 'kubconfig activate'
+creates a session private to the shell and points KUBECONFIG at it, and
+'kubconfig deactivate' revokes it again. Load it from your rc file:
+
+  eval "$(kubconfig shell-init bash)"    # ~/.bashrc
+  eval "$(kubconfig shell-init zsh)"     # ~/.zshrc
+  kubconfig shell-init fish | source     # ~/.config/fish/config.fish
+
+With --deactivate-on-exit the shell's session is also revoked when the shell
+exits. In bash this replaces any other EXIT trap.`,
+	Args:      cobra.ExactArgs(1),
+	ValidArgs: []string{"bash", "zsh", "fish"},
+	Run: func(cmd *cobra.Command, args []string) {
+		onExit, _ := cmd.Flags().GetBool("deactivate-on-exit")
+		hook, err := shellHook(args[0], onExit)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Print(hook)
+	},
+}
+
+// shellHook returns the hook of a shell, optionally revoking the shell's
+// session when it exits
+func shellHook(shell string, deactivateOnExit bool) (string, error) {
+	hook, ok := shellHooks[shell]
+	if !ok {
+		return "", fmt.Errorf("unsupported shell %q (use bash, zsh or fish)", shell)
+	}
+	hook = strings.ReplaceAll(hook, "SHELL", shell)
+	if deactivateOnExit {
+		hook += shellExitHooks[shell]
+	}
+	return hook, nil
+}
+
+func init() {
+	ShellInitCmd.Flags().Bool("deactivate-on-exit", false, "Revoke the shell's session when the shell exits")
+}
+
+// shellEnvCode returns shell code setting or, for empty values, unsetting
+// environment variables
+func shellEnvCode(shell string, names []string, values map[string]string) string {
+	var b strings.Builder
+	for _, name := range names {
+		value, set := values[name]
+		switch {
+		case shell == "fish" && set:
+			fmt.Fprintf(&b, "set -gx %s '%s';\n", name, strings.NewReplacer(`\`, `\\`, `'`, `\'`).Replace(value))
+		case shell == "fish":
+			fmt.Fprintf(&b, "set -e %s;\n", name)
+		case set:
+			fmt.Fprintf(&b, "export %s='%s';\n", name, strings.ReplaceAll(value, `'`, `'\''`))
+		default:
+			fmt.Fprintf(&b, "unset %s;\n", name)
+		}
+	}
+	return b.String()
+}
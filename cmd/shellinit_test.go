@@ -0,0 +1,174 @@
+package cmd
+
+import (
+	"fmt"
+	"kubconfig-cli/config"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// fakeCLIEnv makes the test binary act as the kubconfig executable the
+// shell hooks call, logging its arguments to the file named by fakeCLILogEnv
+const (
+	fakeCLIEnv    = "KUBCONFIG_TEST_FAKE_CLI"
+	fakeCLILogEnv = "KUBCONFIG_TEST_FAKE_CLI_LOG"
+)
+
+const (
+	fakeKubeconfig = "/tmp/kubconfig-test/sessions/fake.yaml"
+	fakeSessionID  = "fake-session"
+)
+
+func TestMain(m *testing.M) {
+	if os.Getenv(fakeCLIEnv) != "" {
+		os.Exit(fakeCLI(os.Args[1:]))
+	}
+	os.Exit(m.Run())
+}
+
+// fakeCLI answers activate and deactivate like the real commands do for a
+// session private to the shell, without touching a cluster
+func fakeCLI(args []string) int {
+	if f, err := os.OpenFile(os.Getenv(fakeCLILogEnv), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600); err == nil {
+		fmt.Fprintln(f, strings.Join(args, " "))
+		f.Close()
+	}
+
+	var shell string
+	for _, arg := range args {
+		if strings.HasPrefix(arg, "--shell-eval=") {
+			shell = strings.TrimPrefix(arg, "--shell-eval=")
+		}
+	}
+	names := []string{"KUBECONFIG", config.SessionEnv}
+	switch {
+	case len(args) == 0:
+		return 1
+	case args[0] == "activate" && shell != "":
+		fmt.Print(shellEnvCode(shell, names, map[string]string{
+			"KUBECONFIG":      fakeKubeconfig,
+			config.SessionEnv: fakeSessionID,
+		}))
+	case args[0] == "deactivate" && shell != "":
+		fmt.Print(shellEnvCode(shell, names, nil))
+	}
+	return 0
+}
+
+// runHook sources the hook of a shell and runs script with the fake
+// kubconfig first on PATH, returning the output and the logged invocations
+func runHook(t *testing.T, shell string, deactivateOnExit bool, script string) (string, string) {
+	path, err := exec.LookPath(shell)
+	if err != nil {
+		t.Skipf("%s is not installed", shell)
+	}
+	hook, err := shellHook(shell, deactivateOnExit)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dir := t.TempDir()
+	exe, err := os.Executable()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(exe, filepath.Join(dir, "kubconfig")); err != nil {
+		t.Fatal(err)
+	}
+	hookFile := filepath.Join(dir, "hook")
+	if err := os.WriteFile(hookFile, []byte(hook), 0600); err != nil {
+		t.Fatal(err)
+	}
+	logFile := filepath.Join(dir, "calls")
+
+	var args []string
+	switch shell {
+	case "bash":
+		args = []string{"--noprofile", "--norc", "-c"}
+	case "zsh":
+		args = []string{"-f", "-c"}
+	case "fish":
+		args = []string{"--no-config", "-c"}
+	}
+	cmd := exec.Command(path, append(args, "source "+hookFile+"\n"+script)...)
+	cmd.Env = append(os.Environ(),
+		"PATH="+dir+string(os.PathListSeparator)+os.Getenv("PATH"),
+		fakeCLIEnv+"=1",
+		fakeCLILogEnv+"="+logFile,
+		"KUBECONFIG=",
+		config.SessionEnv+"=",
+	)
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		t.Fatalf("%s failed: %v\n%s", shell, err, out)
+	}
+	calls, _ := os.ReadFile(logFile)
+	return string(out), string(calls)
+}
+
+// printEnv prints KUBECONFIG and KUBCONFIG_SESSION, or "unset"
+func printEnv(shell string) string {
+	if shell == "fish" {
+		return `for name in KUBECONFIG KUBCONFIG_SESSION
+    if set -q $name; echo "$name=$$name"; else; echo "$name=unset"; end
+end
+`
+	}
+	return `echo "KUBECONFIG=${KUBECONFIG-unset}"
+echo "KUBCONFIG_SESSION=${KUBCONFIG_SESSION-unset}"
+`
+}
+
+func TestShellHookActivateDeactivate(t *testing.T) {
+	for _, shell := range []string{"bash", "zsh", "fish"} {
+		t.Run(shell, func(t *testing.T) {
+			out, calls := runHook(t, shell, false,
+				"kubconfig activate prod.cfg\n"+printEnv(shell)+
+					"kubconfig deactivate\n"+printEnv(shell))
+
+			want := "KUBECONFIG=" + fakeKubeconfig + "\n" +
+				"KUBCONFIG_SESSION=" + fakeSessionID + "\n" +
+				"KUBECONFIG=unset\n" +
+				"KUBCONFIG_SESSION=unset\n"
+			if out != want {
+				t.Errorf("output:\n%s\nwant:\n%s", out, want)
+			}
+			wantCalls := "activate prod.cfg --shell-eval=" + shell + "\n" +
+				"deactivate --shell-eval=" + shell + "\n"
+			if calls != wantCalls {
+				t.Errorf("calls:\n%s\nwant:\n%s", calls, wantCalls)
+			}
+		})
+	}
+}
+
+func TestShellHookDeactivateOnExit(t *testing.T) {
+	for _, shell := range []string{"bash", "zsh", "fish"} {
+		t.Run(shell, func(t *testing.T) {
+			_, calls := runHook(t, shell, true, "kubconfig activate prod.cfg\n")
+
+			want := "activate prod.cfg --shell-eval=" + shell + "\n" +
+				"deactivate --session " + fakeSessionID + "\n"
+			if calls != want {
+				t.Errorf("calls:\n%s\nwant:\n%s", calls, want)
+			}
+		})
+	}
+}
+
+func TestShellHookNoExitHookAfterDeactivate(t *testing.T) {
+	for _, shell := range []string{"bash", "zsh", "fish"} {
+		t.Run(shell, func(t *testing.T) {
+			_, calls := runHook(t, shell, true, "kubconfig activate prod.cfg\nkubconfig deactivate\n")
+
+			want := "activate prod.cfg --shell-eval=" + shell + "\n" +
+				"deactivate --shell-eval=" + shell + "\n"
+			if calls != want {
+				t.Errorf("calls:\n%s\nwant:\n%s", calls, want)
+			}
+		})
+	}
+}
@@ -1,28 +1,243 @@
 package cmd
 
 import (
+	"encoding/json"
+	"errors"
 	"fmt"
 	"kubconfig-cli/config"
+	"os"
+	"path/filepath"
+	"strings"
 	"time"
 
 	"github.com/spf13/cobra"
 )
 
+// Exit codes of the status command
+const (
+	statusActive    = 0
+	statusError     = 1
+	statusExpired   = 2
+	statusNoSession = 3
+)
+
+// sessionStatus is the state of the active session as printed by status
+type sessionStatus struct {
+	Active           bool      `json:"active"`
+	Expired          bool      `json:"expired"`
+	SessionID        string    `json:"session_id,omitempty"`
+	Config           string    `json:"config,omitempty"`
+	Kubeconfig       string    `json:"kubeconfig"`
+	Cluster          string    `json:"cluster,omitempty"`
+	Server           string    `json:"server,omitempty"`
+	AuthMode         string    `json:"auth_mode,omitempty"`
+	User             string    `json:"user,omitempty"`
+	Subject          string    `json:"subject,omitempty"`
+	ServiceAccount   string    `json:"service_account,omitempty"`
+	Namespace        string    `json:"namespace,omitempty"`
+	Role             string    `json:"role,omitempty"`
+	RoleNamespace    string    `json:"role_namespace,omitempty"`
+	Reason           string    `json:"reason,omitempty"`
+	Ticket           string    `json:"ticket,omitempty"`
+	IssuedAt         time.Time `json:"issued_at,omitempty"`
+	ExpiresAt        time.Time `json:"expires_at,omitempty"`
+	RemainingSeconds int64     `json:"remaining_seconds"`
+	Warnings         []string  `json:"warnings,omitempty"`
+}
+
 var StatusCmd = &cobra.Command{
 	Use:   "status",
 	Short: "Check current kubeconfig token status",
+	Long: `Show the active session: cluster, ServiceAccount, role, issue time and
+remaining time. Token claims are decoded locally and cross-checked with the
+session registry; the cluster is not contacted.
+
+Exit codes: 0 active, 1 error, 2 expired, 3 no active session.`,
 	Run: func(cmd *cobra.Command, args []string) {
-		expired, expiry, err := config.VerifyTokenExpiry(config.KubeConfigFile)
+		output, _ := cmd.Flags().GetString("output")
+		status, err := currentStatus()
 		if err != nil {
-			fmt.Printf("Error checking token status: %v\n", err)
-			return
+			if output == "json" {
+				json.NewEncoder(os.Stdout).Encode(map[string]string{"error": err.Error()})
+			} else {
+				fmt.Printf("Error checking token status: %v\n", err)
+			}
+			os.Exit(statusError)
 		}
 
-		if expired {
-			fmt.Printf("Token has expired (expired at %s)\n", expiry.Format(time.RFC3339))
+		if output == "json" {
+			data, _ := json.MarshalIndent(status, "", "  ")
+			fmt.Println(string(data))
 		} else {
-			remaining := time.Until(expiry).Round(time.Second)
-			fmt.Printf("Token is valid (expires in %s)\n", remaining)
+			printStatus(status)
+		}
+
+		switch {
+		case !status.Active:
+			os.Exit(statusNoSession)
+		case status.Expired:
+			os.Exit(statusExpired)
 		}
 	},
 }
+
+func init() {
+	StatusCmd.Flags().StringP("output", "o", "text", "Output format: text or json")
+}
+
+// activeKubeconfig returns the kubeconfig kubectl uses in this shell
+func activeKubeconfig() string {
+	if env := os.Getenv("KUBECONFIG"); env != "" {
+		return filepath.SplitList(env)[0]
+	}
+	return config.KubeConfigFile
+}
+
+// currentStatus decodes the credential of the active kubeconfig and
+// cross-checks it with the session registry
+func currentStatus() (*sessionStatus, error) {
+	status := &sessionStatus{Kubeconfig: activeKubeconfig()}
+
+	registry, err := config.LoadSessionRegistry()
+	if err != nil {
+		return nil, err
+	}
+	session := registry.CurrentSession()
+	if id := os.Getenv(config.SessionEnv); id != "" {
+		session = registry.Get(id)
+	}
+
+	data, err := os.ReadFile(status.Kubeconfig)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	if len(strings.TrimSpace(string(data))) == 0 {
+		if session != nil {
+			status.Warnings = append(status.Warnings, fmt.Sprintf("registry session %s has no kubeconfig at %s", session.ID, status.Kubeconfig))
+		}
+		return status, nil
+	}
+
+	credential, err := config.ReadSessionCredential(data)
+	if errors.Is(err, config.ErrNoSessionCredential) {
+		status.Warnings = append(status.Warnings, fmt.Sprintf("%s holds no session credential", status.Kubeconfig))
+		return status, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	status.Active = true
+	status.AuthMode = credential.AuthMode
+	status.ExpiresAt = credential.ExpiresAt
+	status.Cluster, status.Server, _ = config.KubeconfigCluster(data)
+	if claims := credential.Claims; claims != nil {
+		status.Subject = claims.Subject
+		status.IssuedAt = claims.IssuedAtTime()
+		if claims.Kubernetes != nil {
+			status.Namespace = claims.Kubernetes.Namespace
+			status.ServiceAccount = claims.Kubernetes.ServiceAccount.Name
+		}
+	}
+
+	if session != nil {
+		status.SessionID = session.ID
+		status.Config = session.Config
+		status.User = session.User
+		status.Role = session.Role
+		status.RoleNamespace = session.RoleNamespace
+		status.Reason = session.Reason
+		status.Ticket = session.Ticket
+		if status.IssuedAt.IsZero() {
+			status.IssuedAt = session.CreatedAt
+		}
+		status.Warnings = append(status.Warnings, crossCheckSession(contextSession(session, status.Cluster), credential)...)
+	} else {
+		status.Warnings = append(status.Warnings, "no session registered for this kubeconfig")
+	}
+
+	// Tokens without an exp claim do not expire
+	if status.ExpiresAt.IsZero() {
+		status.Warnings = append(status.Warnings, "the credential has no expiry")
+		return status, nil
+	}
+	status.Expired = time.Now().After(status.ExpiresAt)
+	if !status.Expired {
+		status.RemainingSeconds = int64(time.Until(status.ExpiresAt).Seconds())
+	}
+	return status, nil
+}
+
+// crossCheckSession reports differences between the registry and the
+// credential actually present in the kubeconfig
+func crossCheckSession(session *config.Session, credential *config.SessionCredential) []string {
+	var warnings []string
+	if session.AuthMode != credential.AuthMode {
+		warnings = append(warnings, fmt.Sprintf("registry session %s uses %s authentication but the kubeconfig uses %s", session.ID, session.AuthMode, credential.AuthMode))
+		return warnings
+	}
+	if credential.SessionID != "" && credential.SessionID != session.ID {
+		warnings = append(warnings, fmt.Sprintf("kubeconfig belongs to session %s, not %s", credential.SessionID, session.ID))
+	}
+	if credential.Claims != nil {
+		if username, err := config.SessionUsername(session); err == nil && credential.Claims.Subject != username {
+			warnings = append(warnings, fmt.Sprintf("token subject %s does not match registry session %s (%s)", credential.Claims.Subject, session.ID, username))
+		}
+	}
+	if diff := credential.ExpiresAt.Sub(session.ExpiresAt).Abs(); !credential.ExpiresAt.IsZero() && diff > time.Minute {
+		warnings = append(warnings, fmt.Sprintf("credential expires at %s but the registry expects %s",
+			credential.ExpiresAt.Local().Format(time.RFC3339), session.ExpiresAt.Local().Format(time.RFC3339)))
+	}
+	return warnings
+}
+
+func printStatus(status *sessionStatus) {
+	if !status.Active {
+		fmt.Println("No active session")
+		for _, warning := range status.Warnings {
+			fmt.Printf("Warning: %s\n", warning)
+		}
+		return
+	}
+
+	if status.SessionID != "" {
+		fmt.Printf("Session:         %s (%s)\n", status.SessionID, status.Config)
+	}
+	fmt.Printf("Kubeconfig:      %s\n", status.Kubeconfig)
+	fmt.Printf("Cluster:         %s (%s)\n", status.Cluster, status.Server)
+	fmt.Printf("Authentication:  %s\n", status.AuthMode)
+	if status.ServiceAccount != "" {
+		fmt.Printf("ServiceAccount:  %s/%s\n", status.Namespace, status.ServiceAccount)
+	}
+	if status.Role != "" {
+		role := status.Role
+		if status.RoleNamespace != "" {
+			role += " in namespace " + status.RoleNamespace
+		} else {
+			role += " (cluster-wide)"
+		}
+		fmt.Printf("Role:            %s\n", role)
+	}
+	if status.Reason != "" {
+		fmt.Printf("Reason:          %s\n", status.Reason)
+	}
+	if status.Ticket != "" {
+		fmt.Printf("Ticket:          %s\n", status.Ticket)
+	}
+	if !status.IssuedAt.IsZero() {
+		fmt.Printf("Issued:          %s\n", status.IssuedAt.Local().Format(time.RFC3339))
+	}
+
+	switch {
+	case status.ExpiresAt.IsZero():
+		fmt.Println("Token is valid (does not expire)")
+	case status.Expired:
+		fmt.Printf("Token has expired (expired at %s)\n", status.ExpiresAt.Local().Format(time.RFC3339))
+	default:
+		remaining := time.Until(status.ExpiresAt).Round(time.Second)
+		fmt.Printf("Token is valid (expires in %s, at %s)\n", remaining, status.ExpiresAt.Local().Format(time.RFC3339))
+	}
+
+	for _, warning := range status.Warnings {
+		fmt.Printf("Warning: %s\n", warning)
+	}
+}
@@ -2,28 +2,36 @@ package cmd
 
 import (
 	"encoding/json"
+	"fmt"
+	"kubconfig-cli/config"
 	"os"
+	"os/exec"
 	"time"
 
 	"github.com/spf13/cobra"
 )
 
+type ExecCredentialStatus struct {
+	Token                 string    `json:"token,omitempty"`
+	ClientCertificateData string    `json:"clientCertificateData,omitempty"`
+	ClientKeyData         string    `json:"clientKeyData,omitempty"`
+	ExpirationTimestamp   time.Time `json:"expirationTimestamp"`
+}
+
 type ExecCredential struct {
-	ApiVersion string `json:"apiVersion"`
-	Kind       string `json:"kind"`
-	Status     struct {
-		Token               string    `json:"token"`
-		ExpirationTimestamp time.Time `json:"expirationTimestamp"`
-	} `json:"status"`
+	ApiVersion string               `json:"apiVersion"`
+	Kind       string               `json:"kind"`
+	Status     ExecCredentialStatus `json:"status"`
 }
 
 var TokenCmd = &cobra.Command{
-	Use:    "token",
-	Short:  "Internal command for token management",
-	Hidden: true,
+	Use:   "token",
+	Short: "Credential plugin for session kubeconfigs; see 'token inspect'",
 	Run: func(cmd *cobra.Command, args []string) {
 		origToken, _ := cmd.Flags().GetString("original-token")
 		expiryStr, _ := cmd.Flags().GetString("expiry")
+		sessionID, _ := cmd.Flags().GetString("session")
+		eksCluster, _ := cmd.Flags().GetString("eks-cluster")
 
 		expiry, err := time.Parse(time.RFC3339, expiryStr)
 		if err != nil {
@@ -32,29 +40,111 @@ var TokenCmd = &cobra.Command{
 
 		// Check if token has expired
 		if time.Now().After(expiry) {
+			fmt.Fprintln(os.Stderr, "kubconfig: session has expired, run 'kubconfig activate' again")
 			os.Exit(1)
 		}
 
+		// Wrapped exec plugins produce their own credentials
+		if wrap, _ := cmd.Flags().GetBool("wrap"); wrap {
+			if err := wrapExecPlugin(args, expiry); err != nil {
+				fmt.Fprintf(os.Stderr, "kubconfig: %v\n", err)
+				os.Exit(1)
+			}
+			return
+		}
+
+		status := ExecCredentialStatus{
+			Token:               origToken,
+			ExpirationTimestamp: expiry,
+		}
+
+		// Impersonation sessions authenticate to their local proxy
+		if sessionID != "" {
+			state, err := config.LoadProxyState(sessionID)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "kubconfig: %v\n", err)
+				os.Exit(1)
+			}
+			status.Token = state.Token
+		}
+
+		// EKS sessions mint short-lived IAM tokens capped at the session expiry
+		if eksCluster != "" {
+			region, _ := cmd.Flags().GetString("region")
+			roleARN, _ := cmd.Flags().GetString("aws-role-arn")
+			profile, _ := cmd.Flags().GetString("profile")
+
+			token, tokenExpiry, err := config.GenerateEKSToken(&config.EKSConfig{
+				ClusterName: eksCluster,
+				Region:      region,
+				RoleARN:     roleARN,
+				Profile:     profile,
+			}, expiry)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "kubconfig: %v\n", err)
+				os.Exit(1)
+			}
+			status.Token = token
+			status.ExpirationTimestamp = tokenExpiry
+		}
+
 		// Return valid credentials
 		creds := ExecCredential{
 			ApiVersion: "client.authentication.k8s.io/v1beta1",
 			Kind:       "ExecCredential",
-			Status: struct {
-				Token               string    `json:"token"`
-				ExpirationTimestamp time.Time `json:"expirationTimestamp"`
-			}{
-				Token:               origToken,
-				ExpirationTimestamp: expiry,
-			},
+			Status:     status,
 		}
 
 		json.NewEncoder(os.Stdout).Encode(creds)
 	},
 }
 
+// wrapExecPlugin runs the original exec credential plugin and passes its
+// ExecCredential through, capping the expiration at the session expiry
+func wrapExecPlugin(args []string, expiry time.Time) error {
+	if len(args) == 0 {
+		return fmt.Errorf("no exec plugin to wrap")
+	}
+
+	plugin := exec.Command(args[0], args[1:]...)
+	plugin.Stdin = os.Stdin
+	plugin.Stderr = os.Stderr
+	output, err := plugin.Output()
+	if err != nil {
+		return fmt.Errorf("exec plugin %s failed: %v", args[0], err)
+	}
+
+	// Decode generically so fields unknown to us are passed through untouched
+	var creds map[string]interface{}
+	if err := json.Unmarshal(output, &creds); err != nil {
+		return fmt.Errorf("invalid ExecCredential from %s: %v", args[0], err)
+	}
+
+	status, ok := creds["status"].(map[string]interface{})
+	if !ok {
+		return fmt.Errorf("ExecCredential from %s has no status", args[0])
+	}
+
+	capped := expiry
+	if ts, ok := status["expirationTimestamp"].(string); ok {
+		if pluginExpiry, err := time.Parse(time.RFC3339, ts); err == nil && pluginExpiry.Before(expiry) {
+			capped = pluginExpiry
+		}
+	}
+	status["expirationTimestamp"] = capped.UTC().Format(time.RFC3339)
+
+	return json.NewEncoder(os.Stdout).Encode(creds)
+}
+
 func init() {
 	TokenCmd.Flags().String("original-token", "", "Original token")
 	TokenCmd.Flags().String("original-cert", "", "Original certificate")
 	TokenCmd.Flags().String("original-key", "", "Original key")
 	TokenCmd.Flags().String("expiry", "", "Token expiry time")
+	TokenCmd.Flags().String("session", "", "Impersonation session ID")
+	TokenCmd.Flags().String("eks-cluster", "", "EKS cluster name")
+	TokenCmd.Flags().String("region", "", "AWS region of the EKS cluster")
+	TokenCmd.Flags().String("aws-role-arn", "", "IAM role to assume")
+	TokenCmd.Flags().String("profile", "", "AWS profile")
+	TokenCmd.Flags().Bool("wrap", false, "Run the exec plugin given after -- and cap its credentials at the expiry")
 }
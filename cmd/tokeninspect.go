@@ -0,0 +1,190 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"kubconfig-cli/config"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+var tokenInspectCmd = &cobra.Command{
+	Use:   "inspect [TOKEN]",
+	Short: "Decode a ServiceAccount token and optionally check it is still accepted",
+	Long: `Decode and print the claims of a bound ServiceAccount token: issuer,
+audiences, subject, bound pod or secret and its lifetime. The signature is
+not verified locally.
+
+Without a token argument the token of --kubeconfig (default: the active
+kubeconfig) is inspected; "-" reads the token from stdin. With --review the
+token is submitted as a TokenReview through the master kubeconfig, which shows
+whether the API server still accepts it, e.g. after a leak.`,
+	Args: cobra.MaximumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		token, err := inspectedToken(cmd, args)
+		if err != nil {
+			fmt.Printf("Error: %v\n", err)
+			os.Exit(1)
+		}
+
+		claims, err := config.DecodeTokenClaims(token)
+		if err != nil {
+			fmt.Printf("Error decoding token: %v\n", err)
+			os.Exit(1)
+		}
+
+		var review *config.TokenReviewStatus
+		if doReview, _ := cmd.Flags().GetBool("review"); doReview {
+			master, err := reviewKubeconfig(cmd, claims)
+			if err != nil {
+				fmt.Printf("Error: %v\n", err)
+				os.Exit(1)
+			}
+			if review, err = config.ReviewToken(master, token, claims.Audience); err != nil {
+				fmt.Printf("Error: %v\n", err)
+				os.Exit(1)
+			}
+		}
+
+		if output, _ := cmd.Flags().GetString("output"); output == "json" {
+			data, _ := json.MarshalIndent(struct {
+				Claims            *config.TokenClaims       `json:"claims"`
+				SignatureVerified bool                      `json:"signature_verified"`
+				Review            *config.TokenReviewStatus `json:"review,omitempty"`
+			}{claims, false, review}, "", "  ")
+			fmt.Println(string(data))
+		} else {
+			printClaims(claims)
+			if review != nil {
+				printReview(review)
+			}
+		}
+
+		if review != nil && !review.Authenticated {
+			os.Exit(2)
+		}
+	},
+}
+
+func init() {
+	tokenInspectCmd.Flags().String("kubeconfig", "", "Inspect the token of this kubeconfig (default: the active kubeconfig)")
+	tokenInspectCmd.Flags().Bool("review", false, "Submit a TokenReview to check the API server still accepts the token")
+	tokenInspectCmd.Flags().String("config", "", "Bucket kubeconfig used for --review (default: the token's session)")
+	tokenInspectCmd.Flags().String("context", "", "Context of the --config kubeconfig (default: its current context)")
+	tokenInspectCmd.Flags().StringP("output", "o", "text", "Output format: text or json")
+	tokenInspectCmd.RegisterFlagCompletionFunc("config", completeConfigFlag)
+	TokenCmd.AddCommand(tokenInspectCmd)
+}
+
+// inspectedToken returns the token given as argument, on stdin or in a kubeconfig
+func inspectedToken(cmd *cobra.Command, args []string) (string, error) {
+	if len(args) == 1 {
+		if args[0] != "-" {
+			return args[0], nil
+		}
+		data, err := io.ReadAll(os.Stdin)
+		return strings.TrimSpace(string(data)), err
+	}
+
+	path, _ := cmd.Flags().GetString("kubeconfig")
+	if path == "" {
+		path = activeKubeconfig()
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	credential, err := config.ReadSessionCredential(data)
+	if err != nil {
+		return "", fmt.Errorf("%s: %v", path, err)
+	}
+	if credential.Token == "" {
+		return "", fmt.Errorf("%s uses %s authentication and holds no token", path, credential.AuthMode)
+	}
+	return credential.Token, nil
+}
+
+// reviewKubeconfig returns the master kubeconfig of the cluster that issued
+// a token: the one given with --config or that of the token's session
+func reviewKubeconfig(cmd *cobra.Command, claims *config.TokenClaims) (string, error) {
+	if name, _ := cmd.Flags().GetString("config"); name != "" {
+		name, err := resolveConfigName(name)
+		if err != nil {
+			return "", err
+		}
+		contextName, _ := cmd.Flags().GetString("context")
+		return config.MasterKubeconfig(name, contextName)
+	}
+
+	registry, err := config.LoadSessionRegistry()
+	if err != nil {
+		return "", err
+	}
+	for _, session := range registry.Sessions {
+		if username, err := config.SessionUsername(session); err == nil && username == claims.Subject {
+			return config.MasterKubeconfig(session.Config, session.Context)
+		}
+	}
+	return "", fmt.Errorf("no session found for %s; name the kubeconfig of its cluster with --config", claims.Subject)
+}
+
+func printClaims(claims *config.TokenClaims) {
+	fmt.Printf("Issuer:          %s\n", claims.Issuer)
+	fmt.Printf("Audiences:       %s\n", strings.Join(claims.Audience, ", "))
+	fmt.Printf("Subject:         %s\n", claims.Subject)
+	if k := claims.Kubernetes; k != nil {
+		fmt.Printf("ServiceAccount:  %s/%s (uid %s)\n", k.Namespace, k.ServiceAccount.Name, k.ServiceAccount.UID)
+		if k.Pod != nil {
+			fmt.Printf("Bound to pod:    %s (uid %s)\n", k.Pod.Name, k.Pod.UID)
+		}
+		if k.Secret != nil {
+			fmt.Printf("Bound to secret: %s (uid %s)\n", k.Secret.Name, k.Secret.UID)
+		}
+		if k.Node != nil {
+			fmt.Printf("Node:            %s (uid %s)\n", k.Node.Name, k.Node.UID)
+		}
+	}
+	if claims.ID != "" {
+		fmt.Printf("Token ID:        %s\n", claims.ID)
+	}
+	if t := claims.IssuedAtTime(); !t.IsZero() {
+		fmt.Printf("Issued:          %s\n", t.Local().Format(time.RFC3339))
+	}
+	if t := claims.NotBeforeTime(); !t.IsZero() {
+		fmt.Printf("Not before:      %s\n", t.Local().Format(time.RFC3339))
+	}
+
+	expiry := claims.ExpiresAt()
+	switch {
+	case expiry.IsZero():
+		fmt.Println("Expires:         never")
+	case time.Now().After(expiry):
+		fmt.Printf("Expires:         %s (expired %s ago)\n", expiry.Local().Format(time.RFC3339), time.Since(expiry).Round(time.Second))
+	default:
+		fmt.Printf("Expires:         %s (in %s)\n", expiry.Local().Format(time.RFC3339), time.Until(expiry).Round(time.Second))
+	}
+	if iat := claims.IssuedAtTime(); !iat.IsZero() && !expiry.IsZero() {
+		fmt.Printf("Lifetime:        %s\n", expiry.Sub(iat))
+	}
+	fmt.Println("Signature:       not verified")
+}
+
+func printReview(review *config.TokenReviewStatus) {
+	fmt.Println()
+	if !review.Authenticated {
+		fmt.Println("❌ TokenReview: the API server rejects this token")
+		if review.Error != "" {
+			fmt.Printf("   %s\n", review.Error)
+		}
+		return
+	}
+
+	fmt.Printf("⚠️  TokenReview: the API server accepts this token as %s\n", review.User.Username)
+	if len(review.User.Groups) > 0 {
+		fmt.Printf("   Groups: %s\n", strings.Join(review.User.Groups, ", "))
+	}
+}
@@ -0,0 +1,208 @@
+package cmd
+
+import (
+	"fmt"
+	"kubconfig-cli/config"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+)
+
+var UseCmd = &cobra.Command{
+	Use:   "use [KUBECONFIG_NAME|SESSION_ID]",
+	Short: "Switch ~/.kube/config to another active session",
+	Long: `Make another active session current by copying its kubeconfig to
+~/.kube/config. Sessions are selected by ID or by kubeconfig name or alias;
+with several sessions for one kubeconfig the one expiring last is used.
+Expired sessions are revoked and pruned first.`,
+	Args:              cobra.ExactArgs(1),
+	ValidArgsFunction: completeActiveSessions,
+	Run: func(cmd *cobra.Command, args []string) {
+		registry, err := pruneExpiredSessions()
+		if err != nil {
+			fmt.Printf("Error reading session registry: %v\n", err)
+			return
+		}
+
+		session, err := findActiveSession(registry, args[0])
+		if err != nil {
+			fmt.Printf("Error: %v\n", err)
+			return
+		}
+
+		kubeconfig, err := os.ReadFile(session.Kubeconfig)
+		if err != nil {
+			fmt.Printf("Error reading kubeconfig of session %s: %v\n", session.ID, err)
+			return
+		}
+		if err := os.WriteFile(config.KubeConfigFile, kubeconfig, 0600); err != nil {
+			fmt.Printf("Error saving kubeconfig: %v\n", err)
+			return
+		}
+
+		if err := config.UpdateSessionRegistry(func(registry *config.SessionRegistry) {
+			registry.Current = session.ID
+		}); err != nil {
+			fmt.Printf("Warning: Could not update session registry: %v\n", err)
+		}
+		fmt.Printf("Switched to '%s' (session %s, %s left)\n",
+			session.Config, session.ID, compactDuration(session.Remaining()))
+	},
+}
+
+var LsActiveCmd = &cobra.Command{
+	Use:   "ls-active",
+	Short: "List active sessions with their cluster, role and time remaining",
+	Args:  cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		registry, err := config.LoadSessionRegistry()
+		if err != nil {
+			fmt.Printf("Error reading session registry: %v\n", err)
+			return
+		}
+
+		var active []*config.Session
+		for _, session := range registry.Sessions {
+			if !session.Expired() && !session.Issued && session.SharedWith == "" {
+				active = append(active, session)
+			}
+		}
+		if len(active) == 0 {
+			fmt.Println("No active sessions")
+			return
+		}
+
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "CURRENT\tSESSION\tCONFIG\tCLUSTER\tROLE\tNAMESPACE\tREMAINING\tSCOPE")
+		for _, session := range active {
+			current := ""
+			if session.ID == registry.Current {
+				current = "*"
+			}
+			role := session.Role
+			if role == "" {
+				role = "-"
+			}
+			namespace := session.RoleNamespace
+			if namespace == "" {
+				namespace = "(cluster-wide)"
+			}
+			scope := "default"
+			if !session.Switchable() {
+				// Bound to a shell or command; 'use' cannot switch to it
+				scope = "private"
+			}
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\n", current, session.ID, session.Config,
+				session.Cluster, role, namespace, compactDuration(session.Remaining()), scope)
+		}
+		w.Flush()
+	},
+}
+
+// findActiveSession returns the switchable session with the given ID or,
+// failing that, the one for the given kubeconfig that expires last
+func findActiveSession(registry *config.SessionRegistry, nameOrID string) (*config.Session, error) {
+	if session := registry.Get(nameOrID); session != nil {
+		if !session.Switchable() {
+			return nil, fmt.Errorf("session %s is private to a shell, command or issued kubeconfig", session.ID)
+		}
+		if session.Expired() {
+			return nil, fmt.Errorf("session %s has expired", session.ID)
+		}
+		return session, nil
+	}
+
+	name, err := resolveConfigName(nameOrID)
+	if err != nil {
+		return nil, fmt.Errorf("no session or kubeconfig %s: %v", nameOrID, err)
+	}
+
+	var found *config.Session
+	for _, session := range registry.Sessions {
+		if session.Config == name && session.Switchable() && !session.Expired() {
+			if found == nil || session.ExpiresAt.After(found.ExpiresAt) {
+				found = session
+			}
+		}
+	}
+	if found == nil {
+		return nil, fmt.Errorf("no active session for %s; activate it with 'kubconfig activate %s'", name, nameOrID)
+	}
+	return found, nil
+}
+
+// pruneExpiredSessions revokes and forgets expired sessions that were
+// activated into the default kubeconfig and returns the updated registry
+func pruneExpiredSessions() (*config.SessionRegistry, error) {
+	registry, err := config.LoadSessionRegistry()
+	if err != nil {
+		return nil, err
+	}
+
+	pruned := false
+	for _, session := range registry.Sessions {
+		if !session.Switchable() || !session.Expired() {
+			continue
+		}
+		if err := endSession(session); err != nil {
+			fmt.Printf("Warning: Could not revoke expired session %s: %v\n", session.ID, err)
+			continue
+		}
+		os.Remove(session.Kubeconfig)
+		if session.ID == registry.Current {
+			os.WriteFile(config.KubeConfigFile, []byte(""), 0600)
+		}
+		fmt.Printf("Pruned expired session %s (%s)\n", session.ID, session.Config)
+		pruned = true
+	}
+
+	if !pruned {
+		return registry, nil
+	}
+	return config.LoadSessionRegistry()
+}
+
+// currentSwitchableSession returns the active session in the default
+// kubeconfig, if it can be switched back to
+func currentSwitchableSession() *config.Session {
+	registry, err := config.LoadSessionRegistry()
+	if err != nil {
+		return nil
+	}
+	session := registry.CurrentSession()
+	if session == nil || !session.Switchable() || session.Expired() {
+		return nil
+	}
+	return session
+}
+
+// completeActiveSessions completes the IDs and kubeconfig names of the
+// sessions 'use' can switch to
+func completeActiveSessions(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	if len(args) > 0 {
+		return nil, cobra.ShellCompDirectiveNoFileComp
+	}
+	registry, err := config.LoadSessionRegistry()
+	if err != nil {
+		return nil, cobra.ShellCompDirectiveNoFileComp
+	}
+
+	var completions []string
+	seen := make(map[string]bool)
+	for _, session := range registry.Sessions {
+		if !session.Switchable() || session.Expired() {
+			continue
+		}
+		left := compactDuration(session.Remaining()) + " left"
+		if strings.HasPrefix(session.ID, toComplete) {
+			completions = append(completions, fmt.Sprintf("%s\t%s, %s", session.ID, session.Config, left))
+		}
+		if strings.HasPrefix(session.Config, toComplete) && !seen[session.Config] {
+			completions = append(completions, fmt.Sprintf("%s\t%s", session.Config, left))
+			seen[session.Config] = true
+		}
+	}
+	return completions, cobra.ShellCompDirectiveNoFileComp
+}
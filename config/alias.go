@@ -0,0 +1,115 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// SharedAliasesFile holds the aliases shared by everyone using the bucket
+const SharedAliasesFile = "aliases.yaml"
+
+// Aliases maps short names to kubeconfig names
+type Aliases map[string]string
+
+// Names returns the alias names in order
+func (a Aliases) Names() []string {
+	names := make([]string, 0, len(a))
+	for name := range a {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// LoadAliases reads the personal aliases; there are none if no file exists
+func LoadAliases() (Aliases, error) {
+	data, err := os.ReadFile(AliasFile)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return Aliases{}, nil
+		}
+		return nil, err
+	}
+	return parseAliases(data, AliasFile)
+}
+
+// Save writes the personal aliases
+func (a Aliases) Save() error {
+	if err := os.MkdirAll(filepath.Dir(AliasFile), 0700); err != nil {
+		return err
+	}
+	data, err := yaml.Marshal(a)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(AliasFile, data, 0600)
+}
+
+// LoadSharedAliases fetches the aliases shared through the bucket
+func LoadSharedAliases(cfg Config) (Aliases, error) {
+	data, err := GetObject(cfg, SharedAliasesFile)
+	if err != nil {
+		if IsNotFound(err) {
+			return Aliases{}, nil
+		}
+		return nil, fmt.Errorf("error fetching %s: %v", SharedAliasesFile, err)
+	}
+	return parseAliases(data, SharedAliasesFile)
+}
+
+// SaveSharedAliases replaces the aliases shared through the bucket
+func SaveSharedAliases(cfg Config, aliases Aliases) error {
+	data, err := yaml.Marshal(aliases)
+	if err != nil {
+		return err
+	}
+	return PutObject(cfg, SharedAliasesFile, data)
+}
+
+func parseAliases(data []byte, source string) (Aliases, error) {
+	aliases := Aliases{}
+	if err := yaml.Unmarshal(data, &aliases); err != nil {
+		return nil, fmt.Errorf("error parsing %s: %v", source, err)
+	}
+	return aliases, nil
+}
+
+// ValidateAliasName checks an alias cannot be confused with a kubeconfig
+// name or the previous kubeconfig ("-")
+func ValidateAliasName(name string) error {
+	if name == "" || name == "-" || strings.ContainsAny(name, "=/\\ ") || strings.HasSuffix(name, ".cfg") {
+		return fmt.Errorf("invalid alias name %q (aliases must not end with .cfg or contain '=', '/' or spaces)", name)
+	}
+	return nil
+}
+
+// ResolveConfigName returns the kubeconfig an alias stands for. Personal
+// aliases take precedence over shared ones; names ending in .cfg are
+// returned as they are.
+func ResolveConfigName(cfg Config, name string) (string, error) {
+	if strings.HasSuffix(name, ".cfg") {
+		return name, nil
+	}
+
+	aliases, err := LoadAliases()
+	if err != nil {
+		return "", err
+	}
+	if target, ok := aliases[name]; ok {
+		return target, nil
+	}
+
+	shared, err := LoadSharedAliases(cfg)
+	if err != nil {
+		return "", err
+	}
+	if target, ok := shared[name]; ok {
+		return target, nil
+	}
+	return "", fmt.Errorf("unknown kubeconfig or alias %q", name)
+}
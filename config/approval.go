@@ -0,0 +1,339 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Approval request states
+const (
+	ApprovalPending  = "pending"
+	ApprovalApproved = "approved"
+	ApprovalDenied   = "denied"
+)
+
+const (
+	// DefaultApprovalTTL is how long an approval can be used to activate
+	DefaultApprovalTTL = time.Hour
+
+	// approvalRequestTTL is how long a request waits for a decision
+	approvalRequestTTL = 24 * time.Hour
+)
+
+// ApprovalRequest is a signed request for a privileged activation, stored in
+// the bucket under requests/ until a second user approves or denies it
+type ApprovalRequest struct {
+	ID        string    `json:"id"`
+	Requester string    `json:"requester"`
+	Config    string    `json:"config"`
+	Role      string    `json:"role"`
+	Namespace string    `json:"namespace,omitempty"`
+	Duration  string    `json:"duration"`
+	Reason    string    `json:"reason,omitempty"`
+	Ticket    string    `json:"ticket,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+	ExpiresAt time.Time `json:"expires_at"`
+	Signature string    `json:"signature"`
+
+	Status            string    `json:"status"`
+	Approver          string    `json:"approver,omitempty"`
+	DecidedAt         time.Time `json:"decided_at,omitempty"`
+	ApprovalExpiresAt time.Time `json:"approval_expires_at,omitempty"`
+	DecisionReason    string    `json:"decision_reason,omitempty"`
+	ApproverSignature string    `json:"approver_signature,omitempty"`
+
+	// consumed is set when the approval was used, which is recorded apart
+	// from the request so re-uploading the request cannot undo it
+	consumed bool
+}
+
+// ApprovalConsumption records the activation an approval was used for. It
+// is created once and never overwritten.
+type ApprovalConsumption struct {
+	ID         string    `json:"id"`
+	Requester  string    `json:"requester"`
+	ConsumedAt time.Time `json:"consumed_at"`
+	Signature  string    `json:"signature"`
+}
+
+func approvalRequestObject(id string) string {
+	return fmt.Sprintf("requests/%s.json", id)
+}
+
+func approvalConsumedObject(id string) string {
+	return fmt.Sprintf("requests/%s.consumed", id)
+}
+
+// requestPayload is the part of the request signed by the requester
+func (r *ApprovalRequest) requestPayload() []byte {
+	data, _ := json.Marshal([]interface{}{
+		r.ID, r.Requester, r.Config, r.Role, r.Namespace, r.Duration,
+		r.Reason, r.Ticket, r.CreatedAt.Unix(), r.ExpiresAt.Unix(),
+	})
+	return data
+}
+
+// decisionPayload is the part of the request signed by the approver
+func (r *ApprovalRequest) decisionPayload() []byte {
+	data, _ := json.Marshal([]interface{}{
+		string(r.requestPayload()), r.Status, r.Approver,
+		r.DecidedAt.Unix(), r.ApprovalExpiresAt.Unix(), r.DecisionReason,
+	})
+	return data
+}
+
+// Pending reports whether the request still awaits a decision
+func (r *ApprovalRequest) Pending() bool {
+	return r.Status == ApprovalPending && time.Now().Before(r.ExpiresAt)
+}
+
+// Approved reports whether the request holds an unexpired, unused approval
+func (r *ApprovalRequest) Approved() bool {
+	return r.Status == ApprovalApproved && time.Now().Before(r.ApprovalExpiresAt) && !r.consumed
+}
+
+// Consumed reports whether the approval was already used to activate
+func (r *ApprovalRequest) Consumed() bool {
+	return r.consumed
+}
+
+// Matches reports whether an approval covers the given activation
+func (r *ApprovalRequest) Matches(requester, configName, role, namespace string, duration time.Duration) error {
+	approved, _ := time.ParseDuration(r.Duration)
+	switch {
+	case r.Requester != requester:
+		return fmt.Errorf("request %s was made by %s", r.ID, r.Requester)
+	case r.Config != configName:
+		return fmt.Errorf("request %s is for %s", r.ID, r.Config)
+	case r.Role != role:
+		return fmt.Errorf("request %s is for role %s", r.ID, r.Role)
+	case r.Namespace != namespace:
+		return fmt.Errorf("request %s is for namespace %q", r.ID, r.Namespace)
+	case duration > approved:
+		return fmt.Errorf("request %s was approved for %s", r.ID, r.Duration)
+	}
+	return nil
+}
+
+// CreateApprovalRequest signs a request for req.Requester, the user the
+// policy was evaluated for, and stores it in the bucket
+func CreateApprovalRequest(cfg Config, identity *Identity, req *ApprovalRequest) error {
+	if identity.Name != req.Requester {
+		return fmt.Errorf("your identity %s does not match your user %s", identity.Name, req.Requester)
+	}
+	if err := PublishIdentity(cfg, identity); err != nil {
+		return fmt.Errorf("error publishing key: %v", err)
+	}
+
+	req.CreatedAt = time.Now().UTC().Truncate(time.Second)
+	req.ExpiresAt = req.CreatedAt.Add(approvalRequestTTL)
+	req.Status = ApprovalPending
+
+	signature, err := identity.Sign(req.requestPayload())
+	if err != nil {
+		return err
+	}
+	req.Signature = signature
+
+	return saveApprovalRequest(cfg, req)
+}
+
+func saveApprovalRequest(cfg Config, req *ApprovalRequest) error {
+	data, err := json.MarshalIndent(req, "", "  ")
+	if err != nil {
+		return err
+	}
+	return PutObject(cfg, approvalRequestObject(req.ID), data)
+}
+
+// GetApprovalRequest fetches a request and verifies its signatures
+func GetApprovalRequest(cfg Config, id string) (*ApprovalRequest, error) {
+	data, err := GetObject(cfg, approvalRequestObject(id))
+	if err != nil {
+		if IsNotFound(err) {
+			return nil, fmt.Errorf("request %s not found", id)
+		}
+		return nil, err
+	}
+
+	var req ApprovalRequest
+	if err := json.Unmarshal(data, &req); err != nil {
+		return nil, fmt.Errorf("error parsing request %s: %v", id, err)
+	}
+	if err := verifyApprovalRequest(cfg, &req); err != nil {
+		return nil, err
+	}
+
+	if req.Status == ApprovalApproved {
+		if _, err := GetObject(cfg, approvalConsumedObject(id)); err == nil {
+			req.consumed = true
+		} else if !IsNotFound(err) {
+			return nil, err
+		}
+	}
+	return &req, nil
+}
+
+func verifyApprovalRequest(cfg Config, req *ApprovalRequest) error {
+	requester, err := GetPublicIdentity(cfg, req.Requester)
+	if err != nil {
+		return fmt.Errorf("no key registered for requester %s: %v", req.Requester, err)
+	}
+	if err := requester.Verify(req.requestPayload(), req.Signature); err != nil {
+		return fmt.Errorf("request %s: %v", req.ID, err)
+	}
+
+	if req.Status == ApprovalPending {
+		return nil
+	}
+	if req.Approver == req.Requester {
+		return fmt.Errorf("request %s was decided by its own requester", req.ID)
+	}
+	approver, err := policyApprover(cfg, req.Approver)
+	if err != nil {
+		return fmt.Errorf("request %s: %v", req.ID, err)
+	}
+	if approver.PublicKey == requester.PublicKey {
+		return fmt.Errorf("request %s was decided with the requester's key", req.ID)
+	}
+	if err := approver.Verify(req.decisionPayload(), req.ApproverSignature); err != nil {
+		return fmt.Errorf("request %s: %v", req.ID, err)
+	}
+	return nil
+}
+
+// policyApprover returns the approver with the key pinned in the policy.
+// Anyone can register a key under a new name in the bucket, so only the
+// policy decides who may approve.
+func policyApprover(cfg Config, name string) (*PublicIdentity, error) {
+	policy, err := LoadPolicy(cfg)
+	if err != nil {
+		return nil, err
+	}
+	key, ok := policy.Approvers[name]
+	if !ok {
+		return nil, fmt.Errorf("%s is not an approver in %s", name, PolicyFile)
+	}
+	return &PublicIdentity{Name: name, PublicKey: key}, nil
+}
+
+// DecideApprovalRequest approves or denies a pending request as the given
+// identity. Requesters cannot decide their own requests.
+func DecideApprovalRequest(cfg Config, identity *Identity, id string, approve bool, reason string) (*ApprovalRequest, error) {
+	req, err := GetApprovalRequest(cfg, id)
+	if err != nil {
+		return nil, err
+	}
+	if !req.Pending() {
+		return nil, fmt.Errorf("request %s is not pending (status %s)", id, req.Status)
+	}
+	if req.Requester == identity.Name {
+		return nil, fmt.Errorf("you cannot decide your own request")
+	}
+	approver, err := policyApprover(cfg, identity.Name)
+	if err != nil {
+		return nil, err
+	}
+	public, err := identity.Public()
+	if err != nil {
+		return nil, err
+	}
+	if public.PublicKey != approver.PublicKey {
+		return nil, fmt.Errorf("your key does not match the key of approver %s in %s", identity.Name, PolicyFile)
+	}
+
+	// The same key may be registered under several names
+	requester, err := GetPublicIdentity(cfg, req.Requester)
+	if err != nil {
+		return nil, fmt.Errorf("no key registered for requester %s: %v", req.Requester, err)
+	}
+	if requester.PublicKey == public.PublicKey {
+		return nil, fmt.Errorf("you cannot decide your own request")
+	}
+	if err := PublishIdentity(cfg, identity); err != nil {
+		return nil, fmt.Errorf("error publishing key: %v", err)
+	}
+
+	req.Status = ApprovalDenied
+	if approve {
+		req.Status = ApprovalApproved
+	}
+	req.Approver = identity.Name
+	req.DecidedAt = time.Now().UTC().Truncate(time.Second)
+	req.ApprovalExpiresAt = req.DecidedAt.Add(DefaultApprovalTTL)
+	req.DecisionReason = reason
+
+	signature, err := identity.Sign(req.decisionPayload())
+	if err != nil {
+		return nil, err
+	}
+	req.ApproverSignature = signature
+
+	return req, saveApprovalRequest(cfg, req)
+}
+
+// ConsumeApprovalRequest marks an approval as used by an activation, so the
+// request cannot be resumed again. Of two activations racing for the same
+// approval only one succeeds.
+func ConsumeApprovalRequest(cfg Config, identity *Identity, id string) error {
+	req, err := GetApprovalRequest(cfg, id)
+	if err != nil {
+		return err
+	}
+	if req.Requester != identity.Name {
+		return fmt.Errorf("request %s was made by %s", id, req.Requester)
+	}
+	if !req.Approved() {
+		return fmt.Errorf("request %s holds no unused approval", id)
+	}
+
+	consumption := &ApprovalConsumption{
+		ID:         id,
+		Requester:  identity.Name,
+		ConsumedAt: time.Now().UTC().Truncate(time.Second),
+	}
+	payload, _ := json.Marshal([]interface{}{string(req.decisionPayload()), consumption.ConsumedAt.Unix()})
+	if consumption.Signature, err = identity.Sign(payload); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(consumption, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	err = CreateObject(cfg, approvalConsumedObject(id), data)
+	if err == ErrObjectExists {
+		return fmt.Errorf("the approval of request %s was already used", id)
+	}
+	return err
+}
+
+// ListApprovalRequests returns all requests in the bucket, newest first.
+// Requests with invalid signatures are skipped.
+func ListApprovalRequests(cfg Config) ([]*ApprovalRequest, error) {
+	keys, err := ListObjects(cfg, "requests/")
+	if err != nil {
+		return nil, err
+	}
+
+	var requests []*ApprovalRequest
+	for _, key := range keys {
+		if !strings.HasSuffix(key, ".json") {
+			continue
+		}
+		id := strings.TrimSuffix(strings.TrimPrefix(key, "requests/"), ".json")
+		req, err := GetApprovalRequest(cfg, id)
+		if err != nil {
+			continue
+		}
+		requests = append(requests, req)
+	}
+
+	sort.Slice(requests, func(i, j int) bool {
+		return requests[i].CreatedAt.After(requests[j].CreatedAt)
+	})
+	return requests, nil
+}
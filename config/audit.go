@@ -0,0 +1,456 @@
+package config
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Audited lifecycle events
+const (
+	AuditActivate      = "activate"
+	AuditActivateGroup = "activate-group"
+	AuditDeactivate    = "deactivate"
+	AuditCleanup       = "cleanup"
+	AuditIssue         = "issue"
+	AuditRequest       = "request"
+	AuditApprove       = "approve"
+	AuditDeny          = "deny"
+
+	// AuditInvalid stands for a line of the local log that is not an event
+	AuditInvalid = "invalid"
+)
+
+// Audit results
+const (
+	ResultSuccess = "success"
+	ResultFailure = "failure"
+	ResultDenied  = "denied"
+)
+
+// AuditEvent is one line of the audit trail. Each event includes the hash
+// of the previous one, so removed or edited entries break the chain.
+type AuditEvent struct {
+	Time           time.Time `json:"time"`
+	Event          string    `json:"event"`
+	User           string    `json:"user"`
+	Host           string    `json:"host"`
+	SessionID      string    `json:"session_id,omitempty"`
+	Config         string    `json:"config,omitempty"`
+	Cluster        string    `json:"cluster,omitempty"`
+	Server         string    `json:"server,omitempty"`
+	AuthMode       string    `json:"auth_mode,omitempty"`
+	ServiceAccount string    `json:"service_account,omitempty"`
+	Namespace      string    `json:"namespace,omitempty"`
+	Role           string    `json:"role,omitempty"`
+	RoleNamespace  string    `json:"role_namespace,omitempty"`
+	Duration       string    `json:"duration,omitempty"`
+	ExpiresAt      time.Time `json:"expires_at,omitempty"`
+	Reason         string    `json:"reason,omitempty"`
+	Ticket         string    `json:"ticket,omitempty"`
+	Details        string    `json:"details,omitempty"`
+	Result         string    `json:"result"`
+	Error          string    `json:"error,omitempty"`
+	PrevHash       string    `json:"prev_hash"`
+	Hash           string    `json:"hash"`
+}
+
+// AuditFilter selects events in FilterAudit
+type AuditFilter struct {
+	User      string
+	Cluster   string
+	Config    string
+	SessionID string
+	Event     string
+	Since     time.Time
+}
+
+// NewAuditEvent returns an event pre-filled from a session
+func NewAuditEvent(event string, session *Session) *AuditEvent {
+	e := &AuditEvent{Event: event}
+	if session != nil {
+		e.SessionID = session.ID
+		e.Config = session.Config
+		e.Cluster = session.Cluster
+		e.Server = session.Server
+		e.AuthMode = session.AuthMode
+		e.ServiceAccount = session.ServiceAccount
+		e.Namespace = session.Namespace
+		e.Role = session.Role
+		e.RoleNamespace = session.RoleNamespace
+		e.Reason = session.Reason
+		e.Ticket = session.Ticket
+		e.ExpiresAt = session.ExpiresAt
+		if !session.CreatedAt.IsZero() && !session.ExpiresAt.IsZero() {
+			e.Duration = session.ExpiresAt.Sub(session.CreatedAt).Round(time.Second).String()
+		}
+		if len(session.Members) > 0 {
+			var members []string
+			for _, member := range session.Members {
+				members = append(members, fmt.Sprintf("%s (%s)", member.ID, member.Config))
+			}
+			e.Details = "group of " + strings.Join(members, ", ")
+		}
+	}
+	return e
+}
+
+// computeHash hashes the event, excluding its own hash, chained to PrevHash
+func (e *AuditEvent) computeHash() string {
+	unhashed := *e
+	unhashed.Hash = ""
+	data, _ := json.Marshal(unhashed)
+	sum := sha256.Sum256(append([]byte(e.PrevHash), data...))
+	return hex.EncodeToString(sum[:])
+}
+
+// RecordAudit appends an event to the local audit log and, when enabled,
+// uploads it to the audit/ prefix of the bucket
+func RecordAudit(e *AuditEvent) error {
+	e.Time = time.Now().UTC()
+	if e.User == "" {
+		e.User, _ = CurrentUser()
+	}
+	e.Host, _ = os.Hostname()
+	if e.Result == "" {
+		e.Result = ResultSuccess
+	}
+
+	data, err := appendAuditEvent(AuditLogFile, e)
+	if err != nil {
+		return err
+	}
+
+	// The bucket is only used when asked for, and never under the lock, so
+	// a slow or unreachable bucket does not hold up other processes
+	cfg, err := LoadConfig()
+	if err != nil || !cfg.AuditBucket {
+		return nil
+	}
+	if err := anchorAuditHead(cfg, e); err != nil {
+		return fmt.Errorf("error anchoring audit log: %v", err)
+	}
+	if err := PutObject(cfg, auditObject(e), data); err != nil {
+		return fmt.Errorf("error uploading audit event: %v", err)
+	}
+	return nil
+}
+
+// appendAuditEvent chains an event to the last one of a log and appends it,
+// returning the line written
+func appendAuditEvent(path string, e *AuditEvent) ([]byte, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return nil, err
+	}
+
+	// The chain breaks if two processes append after the same event
+	unlock, err := lockFile(path)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	prev, err := lastAuditHash(path)
+	if err != nil {
+		return nil, err
+	}
+	e.PrevHash = prev
+	e.Hash = e.computeHash()
+
+	data, err := json.Marshal(e)
+	if err != nil {
+		return nil, err
+	}
+
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	if _, err := f.Write(append(data, '\n')); err != nil {
+		return nil, err
+	}
+	if err := os.WriteFile(auditHeadFile(path), []byte(e.Hash), 0600); err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+// AuditHead is the latest event of a local audit log, kept in the bucket so
+// entries removed from the end of the log are noticed
+type AuditHead struct {
+	User string    `json:"user"`
+	Host string    `json:"host"`
+	Hash string    `json:"hash"`
+	Time time.Time `json:"time"`
+}
+
+func auditHeadObject(user, host string) string {
+	return fmt.Sprintf("audit-heads/%s@%s.json", user, host)
+}
+
+// auditHeadFile keeps the hash of the last event next to the log, so
+// appending does not read the whole log
+func auditHeadFile(path string) string {
+	return path + ".head"
+}
+
+func anchorAuditHead(cfg Config, e *AuditEvent) error {
+	data, err := json.Marshal(AuditHead{User: e.User, Host: e.Host, Hash: e.Hash, Time: e.Time})
+	if err != nil {
+		return err
+	}
+	return PutObject(cfg, auditHeadObject(e.User, e.Host), data)
+}
+
+// VerifyAuditAnchor checks that the event anchored in the bucket for this
+// user and host is still part of the local log
+func VerifyAuditAnchor(cfg Config, events []*AuditEvent) ([]string, error) {
+	user, err := CurrentUser()
+	if err != nil {
+		return nil, err
+	}
+	host, _ := os.Hostname()
+	data, err := GetObject(cfg, auditHeadObject(user, host))
+	if err != nil {
+		if IsNotFound(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	var head AuditHead
+	if err := json.Unmarshal(data, &head); err != nil {
+		return nil, fmt.Errorf("invalid audit anchor: %v", err)
+	}
+	for _, e := range events {
+		if e.Hash == head.Hash {
+			return nil, nil
+		}
+	}
+	return []string{fmt.Sprintf("the last event recorded in the bucket (%s) is missing; entries were removed from the end",
+		head.Time.Format(time.RFC3339))}, nil
+}
+
+// auditObject partitions bucket audit events by date
+func auditObject(e *AuditEvent) string {
+	return fmt.Sprintf("audit/%s/%s-%s-%s.json",
+		e.Time.Format("2006/01/02"),
+		e.Time.Format("20060102T150405.000000000Z"),
+		e.Host, e.Hash[:12])
+}
+
+// lastAuditHash returns the hash of the last event of a log, reading the
+// whole log only for logs written before the head file existed
+func lastAuditHash(path string) (string, error) {
+	if info, err := os.Stat(path); err != nil || info.Size() == 0 {
+		return "", nil
+	}
+	if head, err := os.ReadFile(auditHeadFile(path)); err == nil {
+		return strings.TrimSpace(string(head)), nil
+	}
+
+	events, err := ReadAuditLog(path)
+	if err != nil {
+		return "", err
+	}
+	for i := len(events) - 1; i >= 0; i-- {
+		if events[i].Event != AuditInvalid {
+			return events[i].Hash, nil
+		}
+	}
+	return "", nil
+}
+
+// ReadAuditLog reads all events of a local audit log. Lines that are not
+// events are returned as AuditInvalid events rather than failing the read.
+func ReadAuditLog(path string) ([]*AuditEvent, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	defer f.Close()
+
+	var events []*AuditEvent
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 1024*1024), 1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		if strings.TrimSpace(scanner.Text()) == "" {
+			continue
+		}
+		var e AuditEvent
+		if err := json.Unmarshal(scanner.Bytes(), &e); err != nil {
+			e = AuditEvent{
+				Event:  AuditInvalid,
+				Result: ResultFailure,
+				Error:  fmt.Sprintf("line %d: %v", line, err),
+			}
+		}
+		events = append(events, &e)
+	}
+	return events, scanner.Err()
+}
+
+// ReadBucketAudit reads the events uploaded to the bucket since a given day
+func ReadBucketAudit(cfg Config, since time.Time) ([]*AuditEvent, error) {
+	var prefixes []string
+	if since.IsZero() {
+		prefixes = []string{"audit/"}
+	} else {
+		for day := since.UTC().Truncate(24 * time.Hour); !day.After(time.Now().UTC()); day = day.AddDate(0, 0, 1) {
+			prefixes = append(prefixes, "audit/"+day.Format("2006/01/02")+"/")
+		}
+	}
+
+	var events []*AuditEvent
+	for _, prefix := range prefixes {
+		keys, err := ListObjects(cfg, prefix)
+		if err != nil {
+			return nil, err
+		}
+		for _, key := range keys {
+			data, err := GetObject(cfg, key)
+			if err != nil {
+				return nil, err
+			}
+			var e AuditEvent
+			if err := json.Unmarshal(data, &e); err != nil {
+				return nil, fmt.Errorf("invalid audit object %s: %v", key, err)
+			}
+			events = append(events, &e)
+		}
+	}
+
+	sort.SliceStable(events, func(i, j int) bool {
+		return events[i].Time.Before(events[j].Time)
+	})
+	return events, nil
+}
+
+// VerifyAuditChain checks the hash chain of a local audit log and returns a
+// description of every break
+func VerifyAuditChain(events []*AuditEvent) []string {
+	var problems []string
+	prev := ""
+	for i, e := range events {
+		if e.Event == AuditInvalid {
+			problems = append(problems, fmt.Sprintf("entry %d is not a valid event (%s)", i+1, e.Error))
+			prev = ""
+			continue
+		}
+		if e.Hash != e.computeHash() {
+			problems = append(problems, fmt.Sprintf("entry %d (%s %s) was modified", i+1, e.Time.Format(time.RFC3339), e.Event))
+		}
+		if e.PrevHash != prev && (i == 0 || events[i-1].Event != AuditInvalid) {
+			problems = append(problems, fmt.Sprintf("entry %d (%s %s) does not follow the previous entry; entries were removed or reordered", i+1, e.Time.Format(time.RFC3339), e.Event))
+		}
+		prev = e.Hash
+	}
+	return problems
+}
+
+// VerifyBucketAuditChain checks events uploaded from several hosts. Every
+// event must be intact, and after the first uploaded event of a user on a
+// host each event must follow that user's previous one.
+func VerifyBucketAuditChain(events []*AuditEvent) []string {
+	var problems []string
+	last := make(map[string]string)
+	for i, e := range events {
+		if e.Hash != e.computeHash() {
+			problems = append(problems, fmt.Sprintf("event %d (%s %s by %s@%s) was modified", i+1, e.Time.Format(time.RFC3339), e.Event, e.User, e.Host))
+		}
+		chain := e.User + "@" + e.Host
+		if prev, ok := last[chain]; ok && e.PrevHash != prev {
+			problems = append(problems, fmt.Sprintf("event %d (%s %s by %s) does not follow the previous event; events are missing", i+1, e.Time.Format(time.RFC3339), e.Event, chain))
+		}
+		last[chain] = e.Hash
+	}
+	return problems
+}
+
+// FilterAudit returns the events matching a filter
+func FilterAudit(events []*AuditEvent, filter AuditFilter) []*AuditEvent {
+	var matched []*AuditEvent
+	for _, e := range events {
+		switch {
+		case filter.User != "" && e.User != filter.User:
+		case filter.Cluster != "" && e.Cluster != filter.Cluster && e.Server != filter.Cluster:
+		case filter.Config != "" && e.Config != filter.Config:
+		case filter.SessionID != "" && e.SessionID != filter.SessionID:
+		case filter.Event != "" && e.Event != filter.Event:
+		case !filter.Since.IsZero() && e.Time.Before(filter.Since):
+		default:
+			matched = append(matched, e)
+		}
+	}
+	return matched
+}
+
+// SessionFromAudit reconstructs a session from its audit events and returns
+// when it ended: at its expiry or an earlier deactivation
+func SessionFromAudit(events []*AuditEvent, id string) (*Session, time.Time) {
+	var session *Session
+	var ended time.Time
+	for _, e := range events {
+		if e.SessionID != id || e.Result != ResultSuccess {
+			continue
+		}
+		switch e.Event {
+		case AuditActivate:
+			session = &Session{
+				ID:             e.SessionID,
+				Config:         e.Config,
+				Cluster:        e.Cluster,
+				Server:         e.Server,
+				User:           e.User,
+				AuthMode:       e.AuthMode,
+				ServiceAccount: e.ServiceAccount,
+				Namespace:      e.Namespace,
+				Role:           e.Role,
+				RoleNamespace:  e.RoleNamespace,
+				Reason:         e.Reason,
+				Ticket:         e.Ticket,
+				CreatedAt:      e.Time,
+				ExpiresAt:      e.ExpiresAt,
+			}
+			ended = e.ExpiresAt
+		case AuditDeactivate:
+			if session != nil && e.Time.Before(ended) {
+				ended = e.Time
+			}
+		}
+	}
+	return session, ended
+}
+
+// ParseSince parses relative times such as "30d" or "12h", and dates
+func ParseSince(value string) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	if strings.HasSuffix(value, "d") {
+		var days int
+		if _, err := fmt.Sscanf(value, "%dd", &days); err == nil {
+			return time.Now().AddDate(0, 0, -days), nil
+		}
+	}
+	if d, err := time.ParseDuration(value); err == nil {
+		return time.Now().Add(-d), nil
+	}
+	for _, layout := range []string{time.RFC3339, "2006-01-02"} {
+		if t, err := time.ParseInLocation(layout, value, time.Local); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("invalid time %q (use e.g. 30d, 12h or 2006-01-02)", value)
+}
@@ -0,0 +1,212 @@
+package config
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/s3"
+)
+
+func newS3Client(cfg Config) (*s3.S3, error) {
+	sess, err := CreateS3Session(cfg)
+	if err != nil {
+		return nil, fmt.Errorf("error creating AWS session: %v", err)
+	}
+	return s3.New(sess), nil
+}
+
+// GetObject downloads an object from the bucket
+func GetObject(cfg Config, key string) ([]byte, error) {
+	return GetObjectWithContext(context.Background(), cfg, key)
+}
+
+// GetObjectWithContext downloads an object, giving up when ctx is done
+func GetObjectWithContext(ctx context.Context, cfg Config, key string) ([]byte, error) {
+	svc, err := newS3Client(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	output, err := svc.GetObjectWithContext(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(cfg.S3Bucket),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		return nil, err
+	}
+	defer output.Body.Close()
+
+	return io.ReadAll(output.Body)
+}
+
+// PutObject uploads an object to the bucket
+func PutObject(cfg Config, key string, data []byte) error {
+	svc, err := newS3Client(cfg)
+	if err != nil {
+		return err
+	}
+
+	_, err = svc.PutObject(&s3.PutObjectInput{
+		Bucket: aws.String(cfg.S3Bucket),
+		Key:    aws.String(key),
+		Body:   bytes.NewReader(data),
+	})
+	return err
+}
+
+// ErrObjectExists is returned by CreateObject for keys already in the bucket
+var ErrObjectExists = errors.New("object already exists")
+
+// CreateObject uploads an object unless the key exists. S3 rejects the
+// upload with If-None-Match; the existence check covers stores that ignore
+// the header.
+func CreateObject(cfg Config, key string, data []byte) error {
+	svc, err := newS3Client(cfg)
+	if err != nil {
+		return err
+	}
+
+	_, err = svc.HeadObject(&s3.HeadObjectInput{
+		Bucket: aws.String(cfg.S3Bucket),
+		Key:    aws.String(key),
+	})
+	if err == nil {
+		return ErrObjectExists
+	}
+	if !IsNotFound(err) {
+		return err
+	}
+
+	req, _ := svc.PutObjectRequest(&s3.PutObjectInput{
+		Bucket: aws.String(cfg.S3Bucket),
+		Key:    aws.String(key),
+		Body:   bytes.NewReader(data),
+	})
+	req.HTTPRequest.Header.Set("If-None-Match", "*")
+	if err := req.Send(); err != nil {
+		if failure, ok := err.(awserr.RequestFailure); ok && failure.StatusCode() == http.StatusPreconditionFailed {
+			return ErrObjectExists
+		}
+		return err
+	}
+	return nil
+}
+
+// DeleteObject removes an object from the bucket
+func DeleteObject(cfg Config, key string) error {
+	svc, err := newS3Client(cfg)
+	if err != nil {
+		return err
+	}
+
+	_, err = svc.DeleteObject(&s3.DeleteObjectInput{
+		Bucket: aws.String(cfg.S3Bucket),
+		Key:    aws.String(key),
+	})
+	return err
+}
+
+// PresignObject returns a URL anyone can download an object with until it
+// expires. S3 accepts at most seven days.
+func PresignObject(cfg Config, key string, expires time.Duration) (string, error) {
+	if expires > 7*24*time.Hour {
+		return "", fmt.Errorf("presigned URLs expire after at most 7 days, not %s", expires)
+	}
+	svc, err := newS3Client(cfg)
+	if err != nil {
+		return "", err
+	}
+
+	req, _ := svc.GetObjectRequest(&s3.GetObjectInput{
+		Bucket: aws.String(cfg.S3Bucket),
+		Key:    aws.String(key),
+	})
+	return req.Presign(expires)
+}
+
+// ListObjects returns the keys of all objects under a prefix
+func ListObjects(cfg Config, prefix string) ([]string, error) {
+	return listObjects(cfg, &s3.ListObjectsV2Input{
+		Bucket: aws.String(cfg.S3Bucket),
+		Prefix: aws.String(prefix),
+	})
+}
+
+// ListTopLevelObjects lists the keys at the root of the bucket, where the
+// kubeconfigs are, without descending into the audit trail, requests,
+// shares or keys
+func ListTopLevelObjects(cfg Config) ([]string, error) {
+	return listObjects(cfg, &s3.ListObjectsV2Input{
+		Bucket:    aws.String(cfg.S3Bucket),
+		Delimiter: aws.String("/"),
+	})
+}
+
+func listObjects(cfg Config, input *s3.ListObjectsV2Input) ([]string, error) {
+	svc, err := newS3Client(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	var keys []string
+	err = svc.ListObjectsV2Pages(input, func(page *s3.ListObjectsV2Output, lastPage bool) bool {
+		for _, item := range page.Contents {
+			keys = append(keys, aws.StringValue(item.Key))
+		}
+		return true
+	})
+	return keys, err
+}
+
+// GetObjectTags returns the S3 object tags of a kubeconfig
+func GetObjectTags(cfg Config, key string) (map[string]string, error) {
+	return GetObjectTagsWithContext(context.Background(), cfg, key)
+}
+
+// GetObjectTagsWithContext reads the tags of an object, giving up when ctx
+// is done
+func GetObjectTagsWithContext(ctx context.Context, cfg Config, key string) (map[string]string, error) {
+	svc, err := newS3Client(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	output, err := svc.GetObjectTaggingWithContext(ctx, &s3.GetObjectTaggingInput{
+		Bucket: aws.String(cfg.S3Bucket),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	tags := make(map[string]string)
+	for _, tag := range output.TagSet {
+		tags[aws.StringValue(tag.Key)] = aws.StringValue(tag.Value)
+	}
+	return tags, nil
+}
+
+// IsNotFound reports whether an S3 error means the object does not exist
+func IsNotFound(err error) bool {
+	if aerr, ok := err.(awserr.Error); ok {
+		switch aerr.Code() {
+		case s3.ErrCodeNoSuchKey, "NotFound":
+			return true
+		}
+	}
+	return false
+}
+
+// IsKubeconfigKey reports whether a bucket key is a stored kubeconfig rather
+// than one of the tool's own objects
+func IsKubeconfigKey(key string) bool {
+	return !strings.Contains(key, "/") && strings.HasSuffix(key, ".cfg")
+}
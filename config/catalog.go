@@ -0,0 +1,182 @@
+package config
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+// CatalogTTL is how long the cached bucket listing is used before it is
+// refreshed in the background
+const CatalogTTL = 5 * time.Minute
+
+// catalogLockTimeout lets a new refresh start when an earlier one died. A
+// running refresh touches its lock every catalogLockRefresh, so a slow one
+// is not taken for dead.
+const (
+	catalogLockTimeout = time.Minute
+	catalogLockRefresh = catalogLockTimeout / 4
+)
+
+// catalogTagWorkers bounds the concurrent tag lookups of a refresh
+const catalogTagWorkers = 8
+
+// Catalog is a local snapshot of the bucket's kubeconfigs, their tags, the
+// shared aliases and the roles its policy grants, so completion and the
+// picker never wait for S3
+type Catalog struct {
+	UpdatedAt time.Time                    `json:"updated_at"`
+	Configs   []string                     `json:"configs"`
+	Tags      map[string]map[string]string `json:"tags,omitempty"`
+	Aliases   Aliases                      `json:"aliases,omitempty"`
+	Roles     []string                     `json:"roles,omitempty"`
+}
+
+// LoadCatalog reads the cached catalog; it is empty if none was saved yet
+func LoadCatalog() (*Catalog, error) {
+	catalog := &Catalog{}
+	data, err := os.ReadFile(CatalogFile)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return catalog, nil
+		}
+		return nil, err
+	}
+	if err := json.Unmarshal(data, catalog); err != nil {
+		return nil, err
+	}
+	return catalog, nil
+}
+
+// Stale reports whether the catalog is older than CatalogTTL
+func (c *Catalog) Stale() bool {
+	return time.Since(c.UpdatedAt) > CatalogTTL
+}
+
+// Save writes the catalog, replacing the previous file atomically
+func (c *Catalog) Save() error {
+	if err := os.MkdirAll(filepath.Dir(CatalogFile), 0700); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(c, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := CatalogFile + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, CatalogFile)
+}
+
+// RefreshCatalog lists the bucket and its policy and saves the result
+func RefreshCatalog(cfg Config) (*Catalog, error) {
+	keys, err := ListTopLevelObjects(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	catalog := &Catalog{UpdatedAt: time.Now()}
+	for _, key := range keys {
+		if IsKubeconfigKey(key) {
+			catalog.Configs = append(catalog.Configs, key)
+		}
+	}
+	sort.Strings(catalog.Configs)
+	catalog.Tags = fetchTags(cfg, catalog.Configs)
+	if aliases, err := LoadSharedAliases(cfg); err == nil {
+		catalog.Aliases = aliases
+	}
+
+	if policy, err := LoadPolicy(cfg); err == nil {
+		catalog.Roles = policy.RoleNames()
+	}
+	return catalog, catalog.Save()
+}
+
+// Matching returns the kubeconfigs carrying all of the given tags
+func (c *Catalog) Matching(tags map[string]string) []string {
+	var names []string
+	for _, name := range c.Configs {
+		matches := true
+		for key, value := range tags {
+			if c.Tags[name][key] != value {
+				matches = false
+				break
+			}
+		}
+		if matches {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// fetchTags looks up the tags of kubeconfigs in parallel. Objects whose tags
+// cannot be read are left out rather than failing the listing.
+func fetchTags(cfg Config, keys []string) map[string]map[string]string {
+	tags := make(map[string]map[string]string)
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	queue := make(chan string)
+	for i := 0; i < catalogTagWorkers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for key := range queue {
+				objectTags, err := GetObjectTags(cfg, key)
+				if err != nil || len(objectTags) == 0 {
+					continue
+				}
+				mu.Lock()
+				tags[key] = objectTags
+				mu.Unlock()
+			}
+		}()
+	}
+	for _, key := range keys {
+		queue <- key
+	}
+	close(queue)
+	wg.Wait()
+	return tags
+}
+
+// LockCatalogRefresh claims the right to refresh the catalog so concurrent
+// completions start only one refresh. The returned function releases it.
+func LockCatalogRefresh() (func(), bool) {
+	lock := CatalogFile + ".lock"
+	if info, err := os.Stat(lock); err == nil && time.Since(info.ModTime()) > catalogLockTimeout {
+		os.Remove(lock)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(lock), 0700); err != nil {
+		return nil, false
+	}
+	f, err := os.OpenFile(lock, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0600)
+	if err != nil {
+		return nil, false
+	}
+	f.Close()
+
+	done := make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(catalogLockRefresh)
+		defer ticker.Stop()
+		for {
+			select {
+			case now := <-ticker.C:
+				os.Chtimes(lock, now, now)
+			case <-done:
+				return
+			}
+		}
+	}()
+	return func() {
+		close(done)
+		os.Remove(lock)
+	}, true
+}
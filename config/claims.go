@@ -0,0 +1,94 @@
+package config
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Audiences unmarshals the JWT aud claim, which may be a string or a list
+type Audiences []string
+
+func (a *Audiences) UnmarshalJSON(data []byte) error {
+	var single string
+	if err := json.Unmarshal(data, &single); err == nil {
+		*a = Audiences{single}
+		return nil
+	}
+	var list []string
+	if err := json.Unmarshal(data, &list); err != nil {
+		return err
+	}
+	*a = list
+	return nil
+}
+
+// BoundObject references the object a token is bound to
+type BoundObject struct {
+	Name string `json:"name"`
+	UID  string `json:"uid"`
+}
+
+// TokenClaims are the claims of a Kubernetes ServiceAccount token
+type TokenClaims struct {
+	Issuer    string    `json:"iss"`
+	Subject   string    `json:"sub"`
+	Audience  Audiences `json:"aud"`
+	IssuedAt  int64     `json:"iat"`
+	NotBefore int64     `json:"nbf"`
+	Expiry    int64     `json:"exp"`
+	ID        string    `json:"jti,omitempty"`
+
+	Kubernetes *struct {
+		Namespace      string       `json:"namespace"`
+		ServiceAccount BoundObject  `json:"serviceaccount"`
+		Pod            *BoundObject `json:"pod,omitempty"`
+		Secret         *BoundObject `json:"secret,omitempty"`
+		Node           *BoundObject `json:"node,omitempty"`
+	} `json:"kubernetes.io,omitempty"`
+}
+
+// DecodeTokenClaims decodes the claims of a JWT without verifying its
+// signature
+func DecodeTokenClaims(token string) (*TokenClaims, error) {
+	parts := strings.Split(strings.TrimSpace(token), ".")
+	if len(parts) != 3 {
+		return nil, fmt.Errorf("invalid token format")
+	}
+
+	// Decode the payload (second part)
+	payload, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(parts[1], "="))
+	if err != nil {
+		return nil, fmt.Errorf("error decoding token: %v", err)
+	}
+
+	var claims TokenClaims
+	if err := json.Unmarshal(payload, &claims); err != nil {
+		return nil, fmt.Errorf("error parsing token claims: %v", err)
+	}
+	return &claims, nil
+}
+
+// ExpiresAt returns the exp claim as a time
+func (c *TokenClaims) ExpiresAt() time.Time {
+	return unixTime(c.Expiry)
+}
+
+// IssuedAtTime returns the iat claim as a time
+func (c *TokenClaims) IssuedAtTime() time.Time {
+	return unixTime(c.IssuedAt)
+}
+
+// NotBeforeTime returns the nbf claim as a time
+func (c *TokenClaims) NotBeforeTime() time.Time {
+	return unixTime(c.NotBefore)
+}
+
+func unixTime(seconds int64) time.Time {
+	if seconds == 0 {
+		return time.Time{}
+	}
+	return time.Unix(seconds, 0)
+}
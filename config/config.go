@@ -19,6 +19,7 @@ type Config struct {
 	AWSSecretKey   string `json:"aws_secret_key"`
 	S3Endpoint     string `json:"s3_endpoint"`
 	ForcePathStyle bool   `json:"force_path_style"`
+	AuditBucket    bool   `json:"audit_bucket,omitempty"`
 }
 
 func SaveConfig(cfg Config) error {
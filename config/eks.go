@@ -0,0 +1,223 @@
+package config
+
+import (
+	"encoding/base64"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials/stscreds"
+	"github.com/aws/aws-sdk-go/aws/endpoints"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/sts"
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	eksTokenPrefix     = "k8s-aws-v1."
+	eksClusterIDHeader = "x-k8s-aws-id"
+
+	// EKS accepts a presigned token for 15 minutes; refresh a minute early
+	eksTokenLifetime = 14 * time.Minute
+)
+
+var eksServerPattern = regexp.MustCompile(`\.([a-z0-9-]+)\.eks\.amazonaws\.com`)
+
+type EKSConfig struct {
+	ClusterName string
+	Region      string
+	RoleARN     string
+	Profile     string
+}
+
+// DetectEKS returns the EKS settings of a kubeconfig whose user authenticates
+// with `aws eks get-token` or aws-iam-authenticator, or nil for other configs
+func DetectEKS(originalConfig []byte) (*EKSConfig, error) {
+	var kubeconfig map[string]interface{}
+	if err := yaml.Unmarshal(originalConfig, &kubeconfig); err != nil {
+		return nil, fmt.Errorf("error parsing kubeconfig: %v", err)
+	}
+
+	_, userData, err := sessionUser(kubeconfig)
+	if err != nil {
+		return nil, err
+	}
+
+	command, args := execArgs(userData)
+	eks := &EKSConfig{
+		Region:  argValue(args, "--region"),
+		RoleARN: argValue(args, "--role-arn", "-r"),
+		Profile: argValue(args, "--profile"),
+	}
+
+	switch filepath.Base(command) {
+	case "aws":
+		if !strings.Contains(strings.Join(args, " "), "eks get-token") {
+			return nil, nil
+		}
+		eks.ClusterName = argValue(args, "--cluster-name", "--cluster-id")
+	case "aws-iam-authenticator":
+		eks.ClusterName = argValue(args, "-i", "--cluster-id")
+	default:
+		return nil, nil
+	}
+
+	if eks.ClusterName == "" {
+		return nil, fmt.Errorf("EKS exec configuration has no cluster name")
+	}
+
+	// Fall back to the exec environment and the API server hostname
+	env := execEnv(userData)
+	if eks.Profile == "" {
+		eks.Profile = env["AWS_PROFILE"]
+	}
+	if eks.Region == "" {
+		eks.Region = env["AWS_REGION"]
+	}
+	if eks.Region == "" {
+		eks.Region = env["AWS_DEFAULT_REGION"]
+	}
+	if eks.Region == "" {
+		if match := eksServerPattern.FindStringSubmatch(clusterServer(kubeconfig)); match != nil {
+			eks.Region = match[1]
+		}
+	}
+	if eks.Region == "" {
+		return nil, fmt.Errorf("could not determine the region of EKS cluster %s", eks.ClusterName)
+	}
+
+	return eks, nil
+}
+
+func execEnv(userData map[string]interface{}) map[string]string {
+	env := make(map[string]string)
+	execConfig, _ := userData["exec"].(map[string]interface{})
+	entries, _ := execConfig["env"].([]interface{})
+	for _, entry := range entries {
+		if e, ok := entry.(map[string]interface{}); ok {
+			name, _ := e["name"].(string)
+			value, _ := e["value"].(string)
+			env[name] = value
+		}
+	}
+	return env
+}
+
+// clusterServer returns the API server of the current context's cluster
+func clusterServer(kubeconfig map[string]interface{}) string {
+	_, cluster, _, err := contextEntries(kubeconfig, "")
+	if err != nil {
+		return ""
+	}
+	clusterData, _ := cluster["cluster"].(map[string]interface{})
+	server, _ := clusterData["server"].(string)
+	return server
+}
+
+// GenerateEKSToken creates a bearer token for an EKS cluster from a presigned
+// STS GetCallerIdentity request. The token is never valid beyond the session
+// expiry.
+func GenerateEKSToken(eks *EKSConfig, sessionExpiry time.Time) (string, time.Time, error) {
+	remaining := time.Until(sessionExpiry)
+	if remaining <= 0 {
+		return "", time.Time{}, fmt.Errorf("session expired")
+	}
+
+	sess, err := session.NewSessionWithOptions(session.Options{
+		Config: aws.Config{
+			Region:              aws.String(eks.Region),
+			STSRegionalEndpoint: endpoints.RegionalSTSEndpoint,
+		},
+		Profile:           eks.Profile,
+		SharedConfigState: session.SharedConfigEnable,
+	})
+	if err != nil {
+		return "", time.Time{}, fmt.Errorf("error creating AWS session: %v", err)
+	}
+
+	// Assume the session role for no longer than the session itself
+	// (STS enforces a 15 minute minimum)
+	var stsConfig []*aws.Config
+	if eks.RoleARN != "" {
+		user, err := CurrentUser()
+		if err != nil {
+			return "", time.Time{}, err
+		}
+		roleDuration := remaining.Round(time.Second)
+		if roleDuration < 15*time.Minute {
+			roleDuration = 15 * time.Minute
+		}
+		if roleDuration > time.Hour {
+			roleDuration = time.Hour
+		}
+		creds := stscreds.NewCredentials(sess, eks.RoleARN, func(p *stscreds.AssumeRoleProvider) {
+			p.RoleSessionName = "kubconfig-" + user
+			p.Duration = roleDuration
+		})
+		stsConfig = append(stsConfig, &aws.Config{Credentials: creds})
+	}
+
+	svc := sts.New(sess, stsConfig...)
+	req, _ := svc.GetCallerIdentityRequest(&sts.GetCallerIdentityInput{})
+	req.HTTPRequest.Header.Add(eksClusterIDHeader, eks.ClusterName)
+
+	presignedURL, err := req.Presign(60 * time.Second)
+	if err != nil {
+		return "", time.Time{}, fmt.Errorf("error presigning STS request: %v", err)
+	}
+
+	expiry := time.Now().Add(eksTokenLifetime)
+	if expiry.After(sessionExpiry) {
+		expiry = sessionExpiry
+	}
+
+	token := eksTokenPrefix + base64.RawURLEncoding.EncodeToString([]byte(presignedURL))
+	return token, expiry, nil
+}
+
+// ModifyKubeconfigForEKS replaces the EKS exec plugin with kubconfig's own
+// token generator, bounded by the session expiry. The expiry is only an
+// argument of the plugin and the tokens are signed with the user's own AWS
+// credentials, so it is advisory: it keeps honest users from working past
+// the session, not someone who edits the kubeconfig or calls AWS directly.
+func ModifyKubeconfigForEKS(originalConfig []byte, eks *EKSConfig, expiresAt time.Time) ([]byte, error) {
+	var kubeconfig map[string]interface{}
+	if err := yaml.Unmarshal(originalConfig, &kubeconfig); err != nil {
+		return nil, fmt.Errorf("error parsing kubeconfig: %v", err)
+	}
+
+	user, userData, err := sessionUser(kubeconfig)
+	if err != nil {
+		return nil, err
+	}
+
+	executable, err := os.Executable()
+	if err != nil {
+		return nil, err
+	}
+
+	args := []string{
+		"token",
+		"--eks-cluster", eks.ClusterName,
+		"--region", eks.Region,
+	}
+	if eks.RoleARN != "" {
+		args = append(args, "--aws-role-arn", eks.RoleARN)
+	}
+	if eks.Profile != "" {
+		args = append(args, "--profile", eks.Profile)
+	}
+	args = append(args, "--expiry", expiresAt.Format(time.RFC3339))
+
+	execConfig, _ := userData["exec"].(map[string]interface{})
+	execConfig["apiVersion"] = "client.authentication.k8s.io/v1beta1"
+	execConfig["command"] = executable
+	execConfig["args"] = args
+	user["user"] = map[string]interface{}{"exec": execConfig}
+
+	return yaml.Marshal(kubeconfig)
+}
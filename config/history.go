@@ -0,0 +1,81 @@
+package config
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// historySize is the number of kubeconfigs remembered
+const historySize = 50
+
+// HistoryEntry is the last activation of a kubeconfig
+type HistoryEntry struct {
+	Time      time.Time `json:"time"`
+	Config    string    `json:"config"`
+	Role      string    `json:"role,omitempty"`
+	Namespace string    `json:"namespace,omitempty"`
+	Context   string    `json:"context,omitempty"`
+	Duration  string    `json:"duration"`
+	AuthMode  string    `json:"auth_mode,omitempty"`
+}
+
+// LoadHistory returns the recently activated kubeconfigs, most recent first
+func LoadHistory() ([]HistoryEntry, error) {
+	data, err := os.ReadFile(HistoryFile)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	var history []HistoryEntry
+	if err := json.Unmarshal(data, &history); err != nil {
+		return nil, err
+	}
+	return history, nil
+}
+
+// AddHistory records an activation, replacing the earlier entry of the
+// same kubeconfig
+func AddHistory(entry HistoryEntry) error {
+	if err := os.MkdirAll(filepath.Dir(HistoryFile), 0700); err != nil {
+		return err
+	}
+	unlock, err := lockFile(HistoryFile)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	history, err := LoadHistory()
+	if err != nil {
+		return err
+	}
+
+	updated := []HistoryEntry{entry}
+	for _, e := range history {
+		if e.Config != entry.Config && len(updated) < historySize {
+			updated = append(updated, e)
+		}
+	}
+
+	data, err := json.MarshalIndent(updated, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(HistoryFile, data, 0600)
+}
+
+// PreviousConfig returns the most recently activated kubeconfig other than
+// current, like "cd -" returns to the previous directory
+func PreviousConfig(history []HistoryEntry, current string) (HistoryEntry, bool) {
+	for _, entry := range history {
+		if entry.Config != current {
+			return entry, true
+		}
+	}
+	return HistoryEntry{}, false
+}
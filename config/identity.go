@@ -0,0 +1,258 @@
+package config
+
+import (
+	"crypto/ecdh"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Identity is the local signing key used for approval requests and the
+// X25519 key kubeconfigs shared with this user are encrypted to
+type Identity struct {
+	Name          string `json:"name"`
+	PrivateKey    string `json:"ed25519_private_key"`
+	EncryptionKey string `json:"x25519_private_key,omitempty"`
+}
+
+// PublicIdentity is the public part of an identity stored under keys/
+type PublicIdentity struct {
+	Name          string `json:"name"`
+	PublicKey     string `json:"ed25519_public_key"`
+	EncryptionKey string `json:"x25519_public_key,omitempty"`
+}
+
+func publicKeyObject(name string) string {
+	return fmt.Sprintf("keys/%s.json", name)
+}
+
+// LoadIdentity reads the local identity, creating one named after the
+// current user on first use
+func LoadIdentity() (*Identity, error) {
+	data, err := os.ReadFile(IdentityFile)
+	if err == nil {
+		var identity Identity
+		if err := json.Unmarshal(data, &identity); err != nil {
+			return nil, fmt.Errorf("error parsing identity: %v", err)
+		}
+
+		// Identities created before sharing only hold a signing key
+		if identity.EncryptionKey == "" {
+			if err := identity.generateEncryptionKey(); err != nil {
+				return nil, err
+			}
+			if err := identity.Save(); err != nil {
+				return nil, err
+			}
+		}
+		return &identity, nil
+	}
+	if !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	user, err := CurrentUser()
+	if err != nil {
+		return nil, err
+	}
+
+	_, privateKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+
+	identity := &Identity{
+		Name:       user,
+		PrivateKey: base64.StdEncoding.EncodeToString(privateKey),
+	}
+	if err := identity.generateEncryptionKey(); err != nil {
+		return nil, err
+	}
+	if err := identity.Save(); err != nil {
+		return nil, err
+	}
+	return identity, nil
+}
+
+// Save writes the identity to disk
+func (i *Identity) Save() error {
+	if err := os.MkdirAll(filepath.Dir(IdentityFile), 0700); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(i, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(IdentityFile, data, 0600)
+}
+
+func (i *Identity) generateEncryptionKey() error {
+	key, err := ecdh.X25519().GenerateKey(rand.Reader)
+	if err != nil {
+		return err
+	}
+	i.EncryptionKey = base64.StdEncoding.EncodeToString(key.Bytes())
+	return nil
+}
+
+func (i *Identity) decryptionKey() (*ecdh.PrivateKey, error) {
+	key, err := base64.StdEncoding.DecodeString(i.EncryptionKey)
+	if err != nil {
+		return nil, fmt.Errorf("invalid identity encryption key")
+	}
+	return ecdh.X25519().NewPrivateKey(key)
+}
+
+func (i *Identity) signingKey() (ed25519.PrivateKey, error) {
+	key, err := base64.StdEncoding.DecodeString(i.PrivateKey)
+	if err != nil || len(key) != ed25519.PrivateKeySize {
+		return nil, fmt.Errorf("invalid identity key")
+	}
+	return ed25519.PrivateKey(key), nil
+}
+
+// Sign signs data with the identity key
+func (i *Identity) Sign(data []byte) (string, error) {
+	key, err := i.signingKey()
+	if err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(ed25519.Sign(key, data)), nil
+}
+
+// Public returns the public part of the identity
+func (i *Identity) Public() (*PublicIdentity, error) {
+	key, err := i.signingKey()
+	if err != nil {
+		return nil, err
+	}
+	public := &PublicIdentity{
+		Name:      i.Name,
+		PublicKey: base64.StdEncoding.EncodeToString(key.Public().(ed25519.PublicKey)),
+	}
+	if i.EncryptionKey != "" {
+		decryptionKey, err := i.decryptionKey()
+		if err != nil {
+			return nil, err
+		}
+		public.EncryptionKey = base64.StdEncoding.EncodeToString(decryptionKey.PublicKey().Bytes())
+	}
+	return public, nil
+}
+
+// PublishIdentity registers the public key of an identity in the bucket,
+// refusing to replace a different key registered under the same name
+func PublishIdentity(cfg Config, identity *Identity) error {
+	public, err := identity.Public()
+	if err != nil {
+		return err
+	}
+	return RegisterPublicIdentity(cfg, public)
+}
+
+// RegisterPublicIdentity stores a public key in the bucket, e.g. one
+// exported by a customer without bucket access. A registered signing key is
+// never replaced, but an encryption key may be added to it.
+func RegisterPublicIdentity(cfg Config, public *PublicIdentity) error {
+	if err := ValidateIdentityName(public.Name); err != nil {
+		return err
+	}
+	if key, err := base64.StdEncoding.DecodeString(public.PublicKey); err != nil || len(key) != ed25519.PublicKeySize {
+		return fmt.Errorf("invalid public key for %s", public.Name)
+	}
+	if _, err := public.encryptionKey(); public.EncryptionKey != "" && err != nil {
+		return err
+	}
+
+	existing, err := GetPublicIdentity(cfg, public.Name)
+	if err == nil {
+		switch {
+		case existing.PublicKey != public.PublicKey:
+			return fmt.Errorf("a different key is already registered for %s", public.Name)
+		case existing.EncryptionKey == public.EncryptionKey || public.EncryptionKey == "":
+			return nil
+		case existing.EncryptionKey != "":
+			return fmt.Errorf("a different encryption key is already registered for %s", public.Name)
+		}
+	} else if !IsNotFound(err) {
+		return err
+	}
+
+	data, err := json.MarshalIndent(public, "", "  ")
+	if err != nil {
+		return err
+	}
+	return PutObject(cfg, publicKeyObject(public.Name), data)
+}
+
+// ListPublicIdentities returns the names of all registered keys
+func ListPublicIdentities(cfg Config) ([]string, error) {
+	keys, err := ListObjects(cfg, "keys/")
+	if err != nil {
+		return nil, err
+	}
+
+	var names []string
+	for _, key := range keys {
+		if name := strings.TrimSuffix(strings.TrimPrefix(key, "keys/"), ".json"); name != key {
+			names = append(names, name)
+		}
+	}
+	return names, nil
+}
+
+// ValidateIdentityName checks a name can be used as an object key, e.g. a
+// user name or an email address
+func ValidateIdentityName(name string) error {
+	if name == "" || strings.ContainsAny(name, "/\\") || strings.HasPrefix(name, ".") {
+		return fmt.Errorf("invalid identity name %q", name)
+	}
+	return nil
+}
+
+// GetPublicIdentity fetches a registered public key from the bucket
+func GetPublicIdentity(cfg Config, name string) (*PublicIdentity, error) {
+	data, err := GetObject(cfg, publicKeyObject(name))
+	if err != nil {
+		return nil, err
+	}
+
+	var public PublicIdentity
+	if err := json.Unmarshal(data, &public); err != nil {
+		return nil, fmt.Errorf("error parsing key of %s: %v", name, err)
+	}
+	return &public, nil
+}
+
+func (p *PublicIdentity) encryptionKey() (*ecdh.PublicKey, error) {
+	if p.EncryptionKey == "" {
+		return nil, fmt.Errorf("%s has not registered an encryption key; ask them to run 'kubconfig keys register'", p.Name)
+	}
+	key, err := base64.StdEncoding.DecodeString(p.EncryptionKey)
+	if err != nil {
+		return nil, fmt.Errorf("invalid encryption key for %s", p.Name)
+	}
+	public, err := ecdh.X25519().NewPublicKey(key)
+	if err != nil {
+		return nil, fmt.Errorf("invalid encryption key for %s", p.Name)
+	}
+	return public, nil
+}
+
+// Verify checks a signature made by this identity
+func (p *PublicIdentity) Verify(data []byte, signature string) error {
+	key, err := base64.StdEncoding.DecodeString(p.PublicKey)
+	if err != nil || len(key) != ed25519.PublicKeySize {
+		return fmt.Errorf("invalid public key for %s", p.Name)
+	}
+	sig, err := base64.StdEncoding.DecodeString(signature)
+	if err != nil || !ed25519.Verify(ed25519.PublicKey(key), data, sig) {
+		return fmt.Errorf("invalid signature by %s", p.Name)
+	}
+	return nil
+}
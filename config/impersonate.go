@@ -0,0 +1,394 @@
+package config
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/subtle"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// proxyShutdownPath stops the impersonation proxy of a session early
+const proxyShutdownPath = "/.kubconfig/shutdown"
+
+type ImpersonationConfig struct {
+	SessionID string
+	User      string
+	Groups    []string
+	ExpiresAt time.Time
+}
+
+// MasterCredential holds the credentials of the stored kubeconfig user
+type MasterCredential struct {
+	Token                 string    `json:"token,omitempty"`
+	ClientCertificateData string    `json:"client_certificate_data,omitempty"`
+	ClientKeyData         string    `json:"client_key_data,omitempty"`
+	ExpiresAt             time.Time `json:"expires_at"`
+}
+
+func verifyImpersonationAccess() error {
+	for _, resource := range []string{"users", "groups"} {
+		cmd := exec.Command("kubectl", "auth", "can-i", "impersonate", resource)
+		var stderr bytes.Buffer
+		cmd.Stderr = &stderr
+		if err := cmd.Run(); err != nil {
+			return fmt.Errorf("cannot impersonate %s: %v\nkubectl output: %s", resource, err, stderr.String())
+		}
+	}
+	return nil
+}
+
+// ValidateImpersonation checks that a session impersonates only identities
+// derived from the user and the roles the policy grants: the user must be
+// kubconfig:<user> or kubconfig:<user>:<suffix>, and every group must be
+// kubconfig:<role> for the granted role or another role the policy allows
+func ValidateImpersonation(user, asUser string, asGroups []string, role string, allowedRoles []string) error {
+	if asUser != "" && asUser != "kubconfig:"+user && !strings.HasPrefix(asUser, "kubconfig:"+user+":") {
+		return fmt.Errorf("cannot impersonate user %s: only kubconfig:%s or kubconfig:%s:<suffix> is allowed", asUser, user, user)
+	}
+	for _, group := range asGroups {
+		groupRole := strings.TrimPrefix(group, "kubconfig:")
+		switch {
+		case groupRole == group || groupRole == "":
+			return fmt.Errorf("cannot impersonate group %s: only kubconfig:<role> groups are allowed", group)
+		case groupRole != role && !contains(allowedRoles, groupRole):
+			return fmt.Errorf("cannot impersonate group %s: role %s is not allowed by policy", group, groupRole)
+		}
+	}
+	return nil
+}
+
+// CreateImpersonationSession prepares an impersonation session without
+// creating any objects in the cluster
+func CreateImpersonationSession(sessionID string, duration time.Duration, asUser string, asGroups []string) (*ImpersonationConfig, error) {
+	fmt.Println("Creating impersonation session...")
+
+	if err := verifyImpersonationAccess(); err != nil {
+		return nil, fmt.Errorf("impersonation check failed: %v", err)
+	}
+
+	if asUser == "" {
+		user, err := CurrentUser()
+		if err != nil {
+			return nil, err
+		}
+		asUser = "kubconfig:" + user
+	}
+
+	return &ImpersonationConfig{
+		SessionID: sessionID,
+		User:      asUser,
+		Groups:    asGroups,
+		ExpiresAt: time.Now().Add(duration),
+	}, nil
+}
+
+// ImpersonationProxy forwards the requests of an impersonation session to
+// the API server with the master credential, setting the impersonated user
+// and groups itself. Clients authenticate with a per-session token, so the
+// session kubeconfig can neither reach the master credential nor choose
+// whom to impersonate.
+type ImpersonationProxy struct {
+	SessionID  string            `json:"session_id"`
+	Server     string            `json:"server"`
+	CAData     string            `json:"ca_data,omitempty"`
+	Insecure   bool              `json:"insecure,omitempty"`
+	Credential *MasterCredential `json:"credential"`
+	User       string            `json:"user"`
+	Groups     []string          `json:"groups"`
+	Token      string            `json:"token"`
+	ExpiresAt  time.Time         `json:"expires_at"`
+}
+
+// ProxyState locates the running impersonation proxy of a session
+type ProxyState struct {
+	Address   string    `json:"address"`
+	Token     string    `json:"token"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// NewImpersonationProxy prepares the proxy of an impersonation session from
+// the cluster and master credential of the original kubeconfig
+func NewImpersonationProxy(originalConfig []byte, imp *ImpersonationConfig) (*ImpersonationProxy, error) {
+	var kubeconfig map[string]interface{}
+	if err := yaml.Unmarshal(originalConfig, &kubeconfig); err != nil {
+		return nil, fmt.Errorf("error parsing kubeconfig: %v", err)
+	}
+
+	_, cluster, _, err := contextEntries(kubeconfig, "")
+	if err != nil {
+		return nil, err
+	}
+	clusterData, _ := cluster["cluster"].(map[string]interface{})
+	server, _ := clusterData["server"].(string)
+	if server == "" {
+		return nil, fmt.Errorf("kubeconfig cluster has no server")
+	}
+
+	_, userData, err := sessionUser(kubeconfig)
+	if err != nil {
+		return nil, err
+	}
+	cred, err := masterCredential(userData)
+	if err != nil {
+		return nil, err
+	}
+	token := make([]byte, 32)
+	if _, err := rand.Read(token); err != nil {
+		return nil, err
+	}
+
+	proxy := &ImpersonationProxy{
+		SessionID:  imp.SessionID,
+		Server:     server,
+		Credential: cred,
+		User:       imp.User,
+		Groups:     imp.Groups,
+		Token:      hex.EncodeToString(token),
+		ExpiresAt:  imp.ExpiresAt,
+	}
+	proxy.Insecure, _ = clusterData["insecure-skip-tls-verify"].(bool)
+	proxy.CAData, _ = clusterData["certificate-authority-data"].(string)
+	if file, ok := clusterData["certificate-authority"].(string); ok && proxy.CAData == "" {
+		ca, err := os.ReadFile(file)
+		if err != nil {
+			return nil, fmt.Errorf("error reading cluster CA: %v", err)
+		}
+		proxy.CAData = base64.StdEncoding.EncodeToString(ca)
+	}
+	return proxy, nil
+}
+
+// Handler authenticates clients with the session token and forwards their
+// requests as the impersonated identity, dropping any impersonation headers
+// they set themselves
+func (p *ImpersonationProxy) Handler(shutdown func()) (http.Handler, error) {
+	target, err := url.Parse(p.Server)
+	if err != nil {
+		return nil, fmt.Errorf("invalid server %q: %v", p.Server, err)
+	}
+	transport, err := p.transport()
+	if err != nil {
+		return nil, err
+	}
+	proxy := httputil.NewSingleHostReverseProxy(target)
+	proxy.Transport = transport
+	proxy.FlushInterval = -1
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if subtle.ConstantTimeCompare([]byte(r.Header.Get("Authorization")), []byte("Bearer "+p.Token)) != 1 {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+		if r.URL.Path == proxyShutdownPath {
+			w.WriteHeader(http.StatusNoContent)
+			go shutdown()
+			return
+		}
+		if time.Now().After(p.ExpiresAt) {
+			http.Error(w, "kubconfig session has expired", http.StatusUnauthorized)
+			return
+		}
+
+		for name := range r.Header {
+			if strings.HasPrefix(name, "Impersonate-") {
+				r.Header.Del(name)
+			}
+		}
+		r.Header.Del("Authorization")
+		if p.Credential.Token != "" {
+			r.Header.Set("Authorization", "Bearer "+p.Credential.Token)
+		}
+		r.Header.Set("Impersonate-User", p.User)
+		for _, group := range p.Groups {
+			r.Header.Add("Impersonate-Group", group)
+		}
+		proxy.ServeHTTP(w, r)
+	}), nil
+}
+
+// transport connects to the API server with the cluster CA and, for
+// certificate-based master credentials, the client certificate
+func (p *ImpersonationProxy) transport() (*http.Transport, error) {
+	tlsConfig := &tls.Config{InsecureSkipVerify: p.Insecure}
+	if p.CAData != "" {
+		ca, err := base64.StdEncoding.DecodeString(p.CAData)
+		if err != nil {
+			return nil, fmt.Errorf("invalid cluster CA: %v", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(ca) {
+			return nil, fmt.Errorf("invalid cluster CA")
+		}
+		tlsConfig.RootCAs = pool
+	}
+	if p.Credential.ClientCertificateData != "" {
+		certPEM, err := base64.StdEncoding.DecodeString(p.Credential.ClientCertificateData)
+		if err != nil {
+			return nil, fmt.Errorf("invalid client certificate: %v", err)
+		}
+		keyPEM, err := base64.StdEncoding.DecodeString(p.Credential.ClientKeyData)
+		if err != nil {
+			return nil, fmt.Errorf("invalid client key: %v", err)
+		}
+		cert, err := tls.X509KeyPair(certPEM, keyPEM)
+		if err != nil {
+			return nil, fmt.Errorf("invalid client certificate: %v", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = tlsConfig
+	// kubectl exec, attach and port-forward upgrade HTTP/1.1 connections
+	transport.ForceAttemptHTTP2 = false
+	transport.TLSNextProto = map[string]func(string, *tls.Conn) http.RoundTripper{}
+	return transport, nil
+}
+
+// Serve runs the proxy on listener until the session expires or is revoked
+func (p *ImpersonationProxy) Serve(listener net.Listener) error {
+	server := &http.Server{}
+	handler, err := p.Handler(func() { server.Close() })
+	if err != nil {
+		return err
+	}
+	server.Handler = handler
+
+	timer := time.AfterFunc(time.Until(p.ExpiresAt), func() { server.Close() })
+	defer timer.Stop()
+	if err := server.Serve(listener); err != nil && err != http.ErrServerClosed {
+		return err
+	}
+	return nil
+}
+
+// ModifyKubeconfigForImpersonation points the kubeconfig at the session's
+// impersonation proxy and replaces the user with an exec plugin handing out
+// the proxy token until the session expires. The master credential does not
+// appear in the result.
+func ModifyKubeconfigForImpersonation(originalConfig []byte, imp *ImpersonationConfig, address string) ([]byte, error) {
+	var kubeconfig map[string]interface{}
+	if err := yaml.Unmarshal(originalConfig, &kubeconfig); err != nil {
+		return nil, fmt.Errorf("error parsing kubeconfig: %v", err)
+	}
+
+	_, cluster, user, err := contextEntries(kubeconfig, "")
+	if err != nil {
+		return nil, err
+	}
+
+	executable, err := os.Executable()
+	if err != nil {
+		return nil, err
+	}
+
+	cluster["cluster"] = map[string]interface{}{
+		"server": "http://" + address,
+	}
+	user["user"] = map[string]interface{}{
+		"exec": map[string]interface{}{
+			"apiVersion": "client.authentication.k8s.io/v1beta1",
+			"command":    executable,
+			"args": []string{
+				"token",
+				"--session", imp.SessionID,
+				"--expiry", imp.ExpiresAt.Format(time.RFC3339),
+			},
+		},
+	}
+
+	return yaml.Marshal(kubeconfig)
+}
+
+func masterCredential(userData map[string]interface{}) (*MasterCredential, error) {
+	cred := &MasterCredential{}
+	if token, ok := userData["token"].(string); ok {
+		cred.Token = token
+	}
+	if certData, ok := userData["client-certificate-data"].(string); ok {
+		cred.ClientCertificateData = certData
+	}
+	if keyData, ok := userData["client-key-data"].(string); ok {
+		cred.ClientKeyData = keyData
+	}
+
+	if cred.Token == "" && (cred.ClientCertificateData == "" || cred.ClientKeyData == "") {
+		return nil, fmt.Errorf("impersonation requires a token or embedded client certificate in the kubeconfig")
+	}
+	return cred, nil
+}
+
+func proxyStateFile(sessionID string) string {
+	return filepath.Join(CacheDir, fmt.Sprintf("%s.proxy", sessionID))
+}
+
+// SaveProxyState records where the impersonation proxy of a session listens
+func SaveProxyState(sessionID string, state *ProxyState) error {
+	data, err := json.Marshal(state)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(CacheDir, 0700); err != nil {
+		return err
+	}
+	return os.WriteFile(proxyStateFile(sessionID), data, 0600)
+}
+
+// LoadProxyState returns the impersonation proxy of a session, refusing to
+// once the session has expired
+func LoadProxyState(sessionID string) (*ProxyState, error) {
+	data, err := os.ReadFile(proxyStateFile(sessionID))
+	if err != nil {
+		return nil, fmt.Errorf("session %s not found", sessionID)
+	}
+
+	var state ProxyState
+	if err := json.Unmarshal(data, &state); err != nil {
+		return nil, err
+	}
+	if time.Now().After(state.ExpiresAt) {
+		os.Remove(proxyStateFile(sessionID))
+		return nil, fmt.Errorf("session expired")
+	}
+	return &state, nil
+}
+
+// RevokeImpersonation stops the impersonation proxy of a session and
+// forgets it
+func RevokeImpersonation(sessionID string) error {
+	if state, err := LoadProxyState(sessionID); err == nil {
+		req, err := http.NewRequest(http.MethodPost, "http://"+state.Address+proxyShutdownPath, nil)
+		if err != nil {
+			return err
+		}
+		req.Header.Set("Authorization", "Bearer "+state.Token)
+		client := &http.Client{Timeout: 5 * time.Second}
+		if resp, err := client.Do(req); err == nil {
+			resp.Body.Close()
+		}
+	}
+
+	// Sessions of earlier versions cached the encrypted master credential
+	for _, file := range []string{proxyStateFile(sessionID), filepath.Join(CacheDir, sessionID+".creds")} {
+		if err := os.Remove(file); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,245 @@
+package config
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"time"
+)
+
+// KubeAuditEvent is the subset of a Kubernetes audit.k8s.io/v1 Event used
+// to reconstruct what a session did
+type KubeAuditEvent struct {
+	AuditID    string `json:"auditID"`
+	Stage      string `json:"stage"`
+	RequestURI string `json:"requestURI"`
+	Verb       string `json:"verb"`
+	User       struct {
+		Username string `json:"username"`
+	} `json:"user"`
+	ImpersonatedUser *struct {
+		Username string `json:"username"`
+	} `json:"impersonatedUser,omitempty"`
+	SourceIPs []string `json:"sourceIPs"`
+	ObjectRef *struct {
+		Resource    string `json:"resource"`
+		Namespace   string `json:"namespace"`
+		Name        string `json:"name"`
+		APIGroup    string `json:"apiGroup"`
+		Subresource string `json:"subresource"`
+	} `json:"objectRef,omitempty"`
+	ResponseStatus *struct {
+		Code    int    `json:"code"`
+		Reason  string `json:"reason"`
+		Message string `json:"message"`
+	} `json:"responseStatus,omitempty"`
+	RequestReceivedTimestamp time.Time         `json:"requestReceivedTimestamp"`
+	Annotations              map[string]string `json:"annotations,omitempty"`
+}
+
+// MutationSummary counts mutating requests of one verb on one resource
+type MutationSummary struct {
+	Verb      string `json:"verb"`
+	Resource  string `json:"resource"`
+	Namespace string `json:"namespace,omitempty"`
+	Count     int    `json:"count"`
+}
+
+// DeniedRequest is a request the API server refused
+type DeniedRequest struct {
+	Time      time.Time `json:"time"`
+	Verb      string    `json:"verb"`
+	Resource  string    `json:"resource,omitempty"`
+	Namespace string    `json:"namespace,omitempty"`
+	Name      string    `json:"name,omitempty"`
+	URI       string    `json:"uri"`
+	Code      int       `json:"code,omitempty"`
+	Message   string    `json:"message,omitempty"`
+}
+
+// SessionActivity summarises the API requests made during a session
+type SessionActivity struct {
+	Username  string            `json:"username"`
+	From      time.Time         `json:"from"`
+	To        time.Time         `json:"to"`
+	Requests  int               `json:"requests"`
+	First     time.Time         `json:"first_request,omitempty"`
+	Last      time.Time         `json:"last_request,omitempty"`
+	SourceIPs []string          `json:"source_ips,omitempty"`
+	Mutations []MutationSummary `json:"mutations"`
+	Denied    []DeniedRequest   `json:"denied"`
+
+	// SharedServiceAccount marks sessions whose requests cannot be told
+	// apart from those of the user's overlapping sessions
+	SharedServiceAccount bool `json:"shared_service_account,omitempty"`
+}
+
+var mutatingVerbs = map[string]bool{
+	"create":           true,
+	"update":           true,
+	"patch":            true,
+	"delete":           true,
+	"deletecollection": true,
+}
+
+// SessionUsername returns the Kubernetes username a session's requests are
+// logged under
+func SessionUsername(session *Session) (string, error) {
+	if session.AuthMode != AuthServiceAccount || session.ServiceAccount == "" {
+		return "", fmt.Errorf("session %s uses %s authentication; only ServiceAccount sessions can be identified in API audit logs", session.ID, session.AuthMode)
+	}
+	return fmt.Sprintf("system:serviceaccount:%s:%s", session.Namespace, session.ServiceAccount), nil
+}
+
+// SharedServiceAccount reports whether a session used the ServiceAccount
+// earlier versions shared between all sessions of a user, rather than one
+// of its own
+func SharedServiceAccount(session *Session) bool {
+	return session.ServiceAccount != serviceAccountName(session.User, session.ID)
+}
+
+// resourceName formats an object reference like kubectl, e.g. deployments.apps/scale
+func (e *KubeAuditEvent) resourceName() string {
+	if e.ObjectRef == nil {
+		return ""
+	}
+	name := e.ObjectRef.Resource
+	if e.ObjectRef.APIGroup != "" {
+		name += "." + e.ObjectRef.APIGroup
+	}
+	if e.ObjectRef.Subresource != "" {
+		name += "/" + e.ObjectRef.Subresource
+	}
+	return name
+}
+
+func (e *KubeAuditEvent) denied() bool {
+	if e.Annotations["authorization.k8s.io/decision"] == "forbid" {
+		return true
+	}
+	return e.ResponseStatus != nil && (e.ResponseStatus.Code == 401 || e.ResponseStatus.Code == 403)
+}
+
+// AnalyzeKubeAudit reads Kubernetes audit events (one JSON object per line)
+// and summarises the requests of a user within a time window. Events logged
+// at several stages are counted once.
+func AnalyzeKubeAudit(r io.Reader, username string, from, to time.Time) (*SessionActivity, error) {
+	events := make(map[string]*KubeAuditEvent)
+	var order []string
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 1024*1024), 16*1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		data := scanner.Bytes()
+		if len(strings.TrimSpace(string(data))) == 0 {
+			continue
+		}
+
+		var e KubeAuditEvent
+		if err := json.Unmarshal(data, &e); err != nil {
+			return nil, fmt.Errorf("invalid audit event on line %d: %v", line, err)
+		}
+		if e.User.Username != username && (e.ImpersonatedUser == nil || e.ImpersonatedUser.Username != username) {
+			continue
+		}
+		if e.RequestReceivedTimestamp.Before(from) || e.RequestReceivedTimestamp.After(to) {
+			continue
+		}
+
+		id := e.AuditID
+		if id == "" {
+			id = fmt.Sprintf("line-%d", line)
+		}
+		existing, seen := events[id]
+		if !seen {
+			order = append(order, id)
+		}
+		// Later stages carry the response status
+		if !seen || existing.ResponseStatus == nil || e.Stage == "ResponseComplete" {
+			events[id] = &e
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	activity := &SessionActivity{
+		Username:  username,
+		From:      from,
+		To:        to,
+		Mutations: []MutationSummary{},
+		Denied:    []DeniedRequest{},
+	}
+	mutations := make(map[MutationSummary]int)
+	ips := make(map[string]bool)
+
+	for _, id := range order {
+		e := events[id]
+		activity.Requests++
+		if activity.First.IsZero() || e.RequestReceivedTimestamp.Before(activity.First) {
+			activity.First = e.RequestReceivedTimestamp
+		}
+		if e.RequestReceivedTimestamp.After(activity.Last) {
+			activity.Last = e.RequestReceivedTimestamp
+		}
+		for _, ip := range e.SourceIPs {
+			ips[ip] = true
+		}
+
+		namespace := ""
+		if e.ObjectRef != nil {
+			namespace = e.ObjectRef.Namespace
+		}
+
+		if e.denied() {
+			denied := DeniedRequest{
+				Time:      e.RequestReceivedTimestamp,
+				Verb:      e.Verb,
+				Resource:  e.resourceName(),
+				Namespace: namespace,
+				URI:       e.RequestURI,
+			}
+			if e.ObjectRef != nil {
+				denied.Name = e.ObjectRef.Name
+			}
+			if e.ResponseStatus != nil {
+				denied.Code = e.ResponseStatus.Code
+				denied.Message = e.ResponseStatus.Message
+			}
+			activity.Denied = append(activity.Denied, denied)
+			continue
+		}
+
+		failed := e.ResponseStatus != nil && e.ResponseStatus.Code >= 400
+		if mutatingVerbs[e.Verb] && !failed {
+			mutations[MutationSummary{Verb: e.Verb, Resource: e.resourceName(), Namespace: namespace}]++
+		}
+	}
+
+	for m, count := range mutations {
+		m.Count = count
+		activity.Mutations = append(activity.Mutations, m)
+	}
+	sort.Slice(activity.Mutations, func(i, j int) bool {
+		a, b := activity.Mutations[i], activity.Mutations[j]
+		if a.Namespace != b.Namespace {
+			return a.Namespace < b.Namespace
+		}
+		if a.Resource != b.Resource {
+			return a.Resource < b.Resource
+		}
+		return a.Verb < b.Verb
+	})
+	sort.Slice(activity.Denied, func(i, j int) bool {
+		return activity.Denied[i].Time.Before(activity.Denied[j].Time)
+	})
+	for ip := range ips {
+		activity.SourceIPs = append(activity.SourceIPs, ip)
+	}
+	sort.Strings(activity.SourceIPs)
+
+	return activity, nil
+}
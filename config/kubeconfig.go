@@ -0,0 +1,410 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Authentication modes supported by activate
+const (
+	AuthAuto           = "auto"
+	AuthServiceAccount = "serviceaccount"
+	AuthImpersonate    = "impersonate"
+	AuthEKS            = "eks"
+	AuthExec           = "exec"
+)
+
+// sessionUser returns the user entry of the kubeconfig's current context
+// and its credentials
+func sessionUser(kubeconfig map[string]interface{}) (map[string]interface{}, map[string]interface{}, error) {
+	_, _, user, err := contextEntries(kubeconfig, "")
+	if err != nil {
+		return nil, nil, err
+	}
+	userData, ok := user["user"].(map[string]interface{})
+	if !ok {
+		return nil, nil, fmt.Errorf("kubeconfig user has no credentials")
+	}
+	return user, userData, nil
+}
+
+// contextEntries returns the name of a context, the current one if none is
+// given, and the cluster and user entries it refers to
+func contextEntries(kubeconfig map[string]interface{}, contextName string) (string, map[string]interface{}, map[string]interface{}, error) {
+	if contextName == "" {
+		contextName, _ = kubeconfig["current-context"].(string)
+	}
+	contexts, _ := kubeconfig["contexts"].([]interface{})
+	if contextName == "" && len(contexts) == 1 {
+		if context, ok := contexts[0].(map[string]interface{}); ok {
+			contextName, _ = context["name"].(string)
+		}
+	}
+
+	if contextName == "" {
+		// Without contexts the kubeconfig can only mean its one cluster and user
+		clusters, _ := kubeconfig["clusters"].([]interface{})
+		users, _ := kubeconfig["users"].([]interface{})
+		if len(contexts) == 0 && len(clusters) == 1 && len(users) == 1 {
+			cluster, _ := clusters[0].(map[string]interface{})
+			user, _ := users[0].(map[string]interface{})
+			if cluster != nil && user != nil {
+				return "", cluster, user, nil
+			}
+		}
+		if len(users) == 0 {
+			return "", nil, nil, fmt.Errorf("no users found in kubeconfig")
+		}
+		return "", nil, nil, fmt.Errorf("kubeconfig has no current context; choose one with --context")
+	}
+
+	context := namedEntry(kubeconfig, "contexts", contextName)
+	if context == nil {
+		return "", nil, nil, fmt.Errorf("context %q not found in kubeconfig", contextName)
+	}
+	contextData, _ := context["context"].(map[string]interface{})
+	clusterName, _ := contextData["cluster"].(string)
+	userName, _ := contextData["user"].(string)
+
+	cluster := namedEntry(kubeconfig, "clusters", clusterName)
+	if cluster == nil {
+		return "", nil, nil, fmt.Errorf("cluster %q of context %q not found in kubeconfig", clusterName, contextName)
+	}
+	user := namedEntry(kubeconfig, "users", userName)
+	if user == nil {
+		return "", nil, nil, fmt.Errorf("user %q of context %q not found in kubeconfig", userName, contextName)
+	}
+	return contextName, cluster, user, nil
+}
+
+// namedEntry returns the entry of a kubeconfig list (clusters, contexts or
+// users) with the given name
+func namedEntry(kubeconfig map[string]interface{}, section, name string) map[string]interface{} {
+	entries, _ := kubeconfig[section].([]interface{})
+	for _, entry := range entries {
+		if e, ok := entry.(map[string]interface{}); ok && e["name"] == name {
+			return e
+		}
+	}
+	return nil
+}
+
+// MinifyKubeconfig reduces a kubeconfig to one context, the current one if
+// none is given, with only the cluster and user it refers to. It returns the
+// kubeconfig and the name of the context it kept.
+func MinifyKubeconfig(data []byte, contextName string) ([]byte, string, error) {
+	var kubeconfig map[string]interface{}
+	if err := yaml.Unmarshal(data, &kubeconfig); err != nil {
+		return nil, "", fmt.Errorf("error parsing kubeconfig: %v", err)
+	}
+
+	name, cluster, user, err := contextEntries(kubeconfig, contextName)
+	if err != nil {
+		return nil, "", err
+	}
+
+	minimal := map[string]interface{}{
+		"apiVersion": "v1",
+		"kind":       "Config",
+		"clusters":   []interface{}{cluster},
+		"users":      []interface{}{user},
+	}
+	if name != "" {
+		minimal["contexts"] = []interface{}{namedEntry(kubeconfig, "contexts", name)}
+		minimal["current-context"] = name
+	}
+	if preferences, ok := kubeconfig["preferences"]; ok {
+		minimal["preferences"] = preferences
+	}
+
+	out, err := yaml.Marshal(minimal)
+	if err != nil {
+		return nil, "", err
+	}
+	return out, name, nil
+}
+
+// MergeKubeconfigs combines single-context kubeconfigs into one, renaming
+// each context, cluster and user after names[i] so they cannot collide. The
+// first becomes the current context.
+func MergeKubeconfigs(names []string, kubeconfigs [][]byte) ([]byte, error) {
+	var clusters, contexts, users []interface{}
+	for i, data := range kubeconfigs {
+		var kubeconfig map[string]interface{}
+		if err := yaml.Unmarshal(data, &kubeconfig); err != nil {
+			return nil, fmt.Errorf("error parsing kubeconfig of %s: %v", names[i], err)
+		}
+		contextName, cluster, user, err := contextEntries(kubeconfig, "")
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", names[i], err)
+		}
+
+		contextData := map[string]interface{}{}
+		if context := namedEntry(kubeconfig, "contexts", contextName); context != nil {
+			if data, ok := context["context"].(map[string]interface{}); ok {
+				contextData = data
+			}
+		}
+		contextData["cluster"] = names[i]
+		contextData["user"] = names[i]
+
+		cluster["name"] = names[i]
+		user["name"] = names[i]
+		clusters = append(clusters, cluster)
+		users = append(users, user)
+		contexts = append(contexts, map[string]interface{}{
+			"name":    names[i],
+			"context": contextData,
+		})
+	}
+	if len(contexts) == 0 {
+		return nil, fmt.Errorf("no kubeconfigs to merge")
+	}
+
+	return yaml.Marshal(map[string]interface{}{
+		"apiVersion":      "v1",
+		"kind":            "Config",
+		"clusters":        clusters,
+		"contexts":        contexts,
+		"users":           users,
+		"current-context": names[0],
+	})
+}
+
+// KubeconfigContexts returns the context names of a kubeconfig
+func KubeconfigContexts(data []byte) ([]string, error) {
+	var kubeconfig map[string]interface{}
+	if err := yaml.Unmarshal(data, &kubeconfig); err != nil {
+		return nil, fmt.Errorf("error parsing kubeconfig: %v", err)
+	}
+
+	var names []string
+	contexts, _ := kubeconfig["contexts"].([]interface{})
+	for _, entry := range contexts {
+		if context, ok := entry.(map[string]interface{}); ok {
+			if name, ok := context["name"].(string); ok {
+				names = append(names, name)
+			}
+		}
+	}
+	return names, nil
+}
+
+// execArgs returns the exec plugin command and arguments of a kubeconfig user
+func execArgs(userData map[string]interface{}) (string, []string) {
+	execConfig, ok := userData["exec"].(map[string]interface{})
+	if !ok {
+		return "", nil
+	}
+
+	command, _ := execConfig["command"].(string)
+	var args []string
+	if rawArgs, ok := execConfig["args"].([]interface{}); ok {
+		for _, arg := range rawArgs {
+			if s, ok := arg.(string); ok {
+				args = append(args, s)
+			}
+		}
+	}
+	return command, args
+}
+
+// argValue returns the value following a flag in an argument list
+func argValue(args []string, flags ...string) string {
+	for i, arg := range args {
+		for _, flag := range flags {
+			if arg == flag && i+1 < len(args) {
+				return args[i+1]
+			}
+			if len(arg) > len(flag)+1 && arg[:len(flag)+1] == flag+"=" {
+				return arg[len(flag)+1:]
+			}
+		}
+	}
+	return ""
+}
+
+// KubeconfigCluster returns the name and server of the cluster of the
+// kubeconfig's current context
+func KubeconfigCluster(data []byte) (string, string, error) {
+	var kubeconfig map[string]interface{}
+	if err := yaml.Unmarshal(data, &kubeconfig); err != nil {
+		return "", "", fmt.Errorf("error parsing kubeconfig: %v", err)
+	}
+
+	_, cluster, _, err := contextEntries(kubeconfig, "")
+	if err != nil {
+		return "", "", err
+	}
+	name, _ := cluster["name"].(string)
+	return name, clusterServer(kubeconfig), nil
+}
+
+// GetSessionAuthMode reports how a session kubeconfig authenticates and,
+// for impersonation sessions, the session ID
+func GetSessionAuthMode(configPath string) (string, string, error) {
+	data, err := os.ReadFile(configPath)
+	if err != nil {
+		return "", "", err
+	}
+
+	var kubeconfig map[string]interface{}
+	if err := yaml.Unmarshal(data, &kubeconfig); err != nil {
+		return "", "", err
+	}
+
+	_, userData, err := sessionUser(kubeconfig)
+	if err != nil {
+		return "", "", err
+	}
+
+	_, args := execArgs(userData)
+	if len(args) == 0 || args[0] != "token" {
+		return AuthServiceAccount, "", nil
+	}
+
+	switch {
+	case argValue(args, "--session") != "":
+		return AuthImpersonate, argValue(args, "--session"), nil
+	case argValue(args, "--eks-cluster") != "":
+		return AuthEKS, "", nil
+	case contains(args, "--wrap"):
+		return AuthExec, "", nil
+	}
+	return AuthServiceAccount, "", nil
+}
+
+// SessionCredential describes how a session kubeconfig authenticates and
+// until when
+type SessionCredential struct {
+	AuthMode  string
+	SessionID string
+	Token     string
+	Claims    *TokenClaims
+	ExpiresAt time.Time
+}
+
+// ErrNoSessionCredential means a kubeconfig was not created by an activation
+var ErrNoSessionCredential = errors.New("kubeconfig has no session credential")
+
+// ReadSessionCredential reads the credential of a session kubeconfig. Plain
+// ServiceAccount tokens are decoded; exec-based sessions carry their expiry
+// in the `kubconfig token --expiry` arguments.
+func ReadSessionCredential(data []byte) (*SessionCredential, error) {
+	var kubeconfig map[string]interface{}
+	if err := yaml.Unmarshal(data, &kubeconfig); err != nil {
+		return nil, fmt.Errorf("error parsing kubeconfig: %v", err)
+	}
+
+	_, userData, err := sessionUser(kubeconfig)
+	if err != nil {
+		return nil, err
+	}
+
+	if token, ok := userData["token"].(string); ok && token != "" {
+		claims, err := DecodeTokenClaims(token)
+		if err != nil {
+			return nil, err
+		}
+		return &SessionCredential{
+			AuthMode:  AuthServiceAccount,
+			Token:     token,
+			Claims:    claims,
+			ExpiresAt: claims.ExpiresAt(),
+		}, nil
+	}
+
+	_, args := execArgs(userData)
+	if len(args) == 0 || args[0] != "token" {
+		return nil, ErrNoSessionCredential
+	}
+
+	credential := &SessionCredential{AuthMode: AuthExec, SessionID: argValue(args, "--session")}
+	switch {
+	case credential.SessionID != "":
+		credential.AuthMode = AuthImpersonate
+	case argValue(args, "--eks-cluster") != "":
+		credential.AuthMode = AuthEKS
+	}
+
+	expiry := argValue(args, "--expiry")
+	if expiry == "" {
+		return nil, fmt.Errorf("no session expiry found")
+	}
+	if credential.ExpiresAt, err = time.Parse(time.RFC3339, expiry); err != nil {
+		return nil, fmt.Errorf("invalid session expiry %q: %v", expiry, err)
+	}
+	return credential, nil
+}
+
+// ModifyKubeconfigForExec wraps the exec credential plugin of the kubeconfig
+// user in `kubconfig token --wrap` so it stops handing out credentials once
+// the session expires
+func ModifyKubeconfigForExec(originalConfig []byte, expiresAt time.Time) ([]byte, error) {
+	var kubeconfig map[string]interface{}
+	if err := yaml.Unmarshal(originalConfig, &kubeconfig); err != nil {
+		return nil, fmt.Errorf("error parsing kubeconfig: %v", err)
+	}
+
+	user, userData, err := sessionUser(kubeconfig)
+	if err != nil {
+		return nil, err
+	}
+
+	command, args := execArgs(userData)
+	if command == "" {
+		return nil, fmt.Errorf("kubeconfig user does not use an exec credential plugin")
+	}
+
+	executable, err := os.Executable()
+	if err != nil {
+		return nil, err
+	}
+
+	wrapped := []string{
+		"token",
+		"--wrap",
+		"--expiry", expiresAt.Format(time.RFC3339),
+		"--",
+		command,
+	}
+
+	execConfig := userData["exec"].(map[string]interface{})
+	execConfig["command"] = executable
+	execConfig["args"] = append(wrapped, args...)
+
+	// Keep only the wrapped plugin, so no other credential outlives the session
+	user["user"] = map[string]interface{}{"exec": execConfig}
+
+	return yaml.Marshal(kubeconfig)
+}
+
+// UsesExecPlugin reports whether the kubeconfig user authenticates with an
+// exec credential plugin
+func UsesExecPlugin(originalConfig []byte) (bool, error) {
+	var kubeconfig map[string]interface{}
+	if err := yaml.Unmarshal(originalConfig, &kubeconfig); err != nil {
+		return false, fmt.Errorf("error parsing kubeconfig: %v", err)
+	}
+
+	_, userData, err := sessionUser(kubeconfig)
+	if err != nil {
+		return false, err
+	}
+
+	command, _ := execArgs(userData)
+	return command != "", nil
+}
+
+func contains(list []string, value string) bool {
+	for _, item := range list {
+		if item == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,104 @@
+package config
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+const certKubeconfig = `apiVersion: v1
+kind: Config
+current-context: prod
+contexts:
+- name: prod
+  context: {cluster: prod, user: admin}
+- name: staging
+  context: {cluster: staging, user: staging-admin}
+clusters:
+- name: prod
+  cluster: {server: https://prod.example.com, certificate-authority-data: Y2E=}
+- name: staging
+  cluster: {server: https://staging.example.com}
+users:
+- name: admin
+  user: {client-certificate-data: Y2VydA==, client-key-data: a2V5, token: master}
+- name: staging-admin
+  user: {token: staging}
+`
+
+const execKubeconfig = `apiVersion: v1
+kind: Config
+current-context: gke
+contexts:
+- name: gke
+  context: {cluster: gke, user: gke}
+clusters:
+- name: gke
+  cluster: {server: https://gke.example.com}
+users:
+- name: gke
+  user:
+    exec:
+      apiVersion: client.authentication.k8s.io/v1beta1
+      command: gke-gcloud-auth-plugin
+    auth-provider:
+      name: gcp
+`
+
+// kubeconfigUsers returns the credentials of every user of a kubeconfig
+func kubeconfigUsers(t *testing.T, data []byte) []map[string]interface{} {
+	t.Helper()
+	var kubeconfig map[string]interface{}
+	if err := yaml.Unmarshal(data, &kubeconfig); err != nil {
+		t.Fatal(err)
+	}
+	var users []map[string]interface{}
+	entries, _ := kubeconfig["users"].([]interface{})
+	for _, entry := range entries {
+		user, _ := entry.(map[string]interface{})["user"].(map[string]interface{})
+		users = append(users, user)
+	}
+	return users
+}
+
+func TestSessionKubeconfigKeepsOnlyToken(t *testing.T) {
+	for name, original := range map[string]string{"cert": certKubeconfig, "exec": execKubeconfig} {
+		t.Run(name, func(t *testing.T) {
+			minified, _, err := MinifyKubeconfig([]byte(original), "")
+			if err != nil {
+				t.Fatal(err)
+			}
+			session, err := ModifyKubeconfigWithToken(minified, "session-token")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			want := []map[string]interface{}{{"token": "session-token"}}
+			if users := kubeconfigUsers(t, session); !reflect.DeepEqual(users, want) {
+				t.Errorf("users = %v, want %v", users, want)
+			}
+
+			merged, err := MergeKubeconfigs([]string{"a", "b"}, [][]byte{session, session})
+			if err != nil {
+				t.Fatal(err)
+			}
+			want = append(want, want[0])
+			if users := kubeconfigUsers(t, merged); !reflect.DeepEqual(users, want) {
+				t.Errorf("merged users = %v, want %v", users, want)
+			}
+		})
+	}
+}
+
+func TestExecSessionKubeconfigKeepsOnlyPlugin(t *testing.T) {
+	session, err := ModifyKubeconfigForExec([]byte(execKubeconfig), time.Now().Add(time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	users := kubeconfigUsers(t, session)
+	if len(users) != 1 || len(users[0]) != 1 || users[0]["exec"] == nil {
+		t.Errorf("users = %v, want only the wrapped exec plugin", users)
+	}
+}
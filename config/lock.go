@@ -0,0 +1,40 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"time"
+)
+
+// lockWait bounds how long a writer waits for another process's lock
+const lockWait = 10 * time.Second
+
+// lockStale is when a lock is assumed to be left behind by a dead process
+const lockStale = 30 * time.Second
+
+// lockFile serializes writers of a file across processes, e.g. the
+// activations of a group, with an adjacent lock file. The returned function
+// releases it.
+func lockFile(path string) (func(), error) {
+	lock := path + ".lock"
+	deadline := time.Now().Add(lockWait)
+	for {
+		f, err := os.OpenFile(lock, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0600)
+		if err == nil {
+			f.Close()
+			return func() { os.Remove(lock) }, nil
+		}
+		if !os.IsExist(err) {
+			return nil, err
+		}
+
+		if info, err := os.Stat(lock); err == nil && time.Since(info.ModTime()) > lockStale {
+			os.Remove(lock)
+			continue
+		}
+		if time.Now().After(deadline) {
+			return nil, fmt.Errorf("timed out waiting for %s", lock)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
@@ -15,6 +15,22 @@ var (
 	SessionDir = filepath.Join(KubeDir, "sessions")
 	CacheDir   = filepath.Join(KubeDir, "cache")
 
+	// Registry of activated sessions
+	SessionRegistryFile = filepath.Join(KubeDir, "kubconfig-sessions.json")
+
+	// Signing identity for approval requests
+	IdentityFile = filepath.Join(KubeDir, "kubconfig-identity.json")
+
+	// Append-only, hash-chained audit trail
+	AuditLogFile = filepath.Join(KubeDir, "kubconfig-audit.log")
+
+	// Cached bucket listing used for shell completion
+	CatalogFile = filepath.Join(KubeDir, "kubconfig-catalog.json")
+
+	// Recently activated kubeconfigs and personal aliases
+	HistoryFile = filepath.Join(KubeDir, "kubconfig-history.json")
+	AliasFile   = filepath.Join(KubeDir, "kubconfig-aliases.yaml")
+
 	// Active kubeconfig file
 	KubeConfigFile = filepath.Join(KubeDir, "config")
 )
@@ -24,6 +40,12 @@ func GetSessionConfig(name string) string {
 	return filepath.Join(SessionDir, fmt.Sprintf("%s-%d.config", name, os.Getpid()))
 }
 
+// GetSessionFile returns where the kubeconfig of a session activated into
+// the default kubeconfig is kept, so 'use' can switch back to it
+func GetSessionFile(id string) string {
+	return filepath.Join(SessionDir, id+".config")
+}
+
 // SetKubeconfig sets the KUBECONFIG environment variable
 func SetKubeconfig(path string) error {
 	return os.Setenv("KUBECONFIG", path)
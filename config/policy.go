@@ -0,0 +1,437 @@
+package config
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// PolicyFile is the name of the policy object stored alongside the kubeconfigs
+const PolicyFile = "policy.yaml"
+
+// DefaultRole is granted when neither the user nor the policy picks a role
+const DefaultRole = "cluster-admin"
+
+// Duration is a time.Duration that unmarshals from strings such as "4h"
+type Duration time.Duration
+
+func (d *Duration) UnmarshalYAML(value *yaml.Node) error {
+	parsed, err := time.ParseDuration(value.Value)
+	if err != nil {
+		return fmt.Errorf("invalid duration %q: %v", value.Value, err)
+	}
+	*d = Duration(parsed)
+	return nil
+}
+
+func (d Duration) MarshalYAML() (interface{}, error) {
+	return time.Duration(d).String(), nil
+}
+
+type Policy struct {
+	// Groups maps group names to their members
+	Groups map[string][]string `yaml:"groups,omitempty"`
+	// Approvers maps the users who may approve requests to their Ed25519
+	// public keys, as printed by 'kubconfig keys export'
+	Approvers map[string]string `yaml:"approvers,omitempty"`
+	Defaults  PolicyRule        `yaml:"defaults"`
+	Rules     []PolicyRule      `yaml:"rules,omitempty"`
+	Webhooks  []Webhook         `yaml:"webhooks,omitempty"`
+}
+
+// PolicyRule applies to kubeconfigs matching all of its name globs and tags.
+// Unset fields fall back to the policy defaults.
+type PolicyRule struct {
+	Name            string            `yaml:"name,omitempty"`
+	Configs         []string          `yaml:"configs,omitempty"`
+	Tags            map[string]string `yaml:"tags,omitempty"`
+	MinDuration     Duration          `yaml:"min_duration,omitempty"`
+	MaxDuration     Duration          `yaml:"max_duration,omitempty"`
+	DefaultDuration Duration          `yaml:"default_duration,omitempty"`
+	Roles           []string          `yaml:"roles,omitempty"`
+	Namespaces      []string          `yaml:"namespaces,omitempty"`
+	Users           []string          `yaml:"users,omitempty"`
+	Groups          []string          `yaml:"groups,omitempty"`
+	RequireReason   bool              `yaml:"require_reason,omitempty"`
+	RequireApproval bool              `yaml:"require_approval,omitempty"`
+	Windows         []TimeWindow      `yaml:"windows,omitempty"`
+}
+
+// TimeWindow allows activations on the given days between start and end
+// (HH:MM). Windows ending before they start span midnight.
+type TimeWindow struct {
+	Days     []string `yaml:"days,omitempty"`
+	Start    string   `yaml:"start"`
+	End      string   `yaml:"end"`
+	Timezone string   `yaml:"timezone,omitempty"`
+}
+
+type AccessRequest struct {
+	Config    string
+	Tags      map[string]string
+	User      string
+	Groups    []string
+	Role      string
+	Namespace string
+	Duration  time.Duration
+	Reason    string
+	Time      time.Time
+}
+
+type Decision struct {
+	Allowed         bool
+	Rule            string
+	Role            string
+	Roles           []string
+	Namespaces      []string
+	Duration        time.Duration
+	MaxDuration     time.Duration
+	RequireReason   bool
+	RequireApproval bool
+	Notes           []string
+	Denials         []string
+}
+
+// Restricted reports whether the decision limits roles or namespaces, which
+// only ServiceAccount sessions can enforce in full
+func (d *Decision) Restricted() bool {
+	return len(d.Roles) > 0 || len(d.Namespaces) > 0
+}
+
+// DefaultPolicy matches the limits used when no policy file exists
+func DefaultPolicy() *Policy {
+	return &Policy{
+		Defaults: PolicyRule{
+			Name:            "default",
+			MinDuration:     Duration(10 * time.Minute),
+			MaxDuration:     Duration(24 * time.Hour),
+			DefaultDuration: Duration(8 * time.Hour),
+		},
+	}
+}
+
+// LoadPolicy reads the policy from the bucket, falling back to the default
+// policy when the bucket has none
+func LoadPolicy(cfg Config) (*Policy, error) {
+	return LoadPolicyWithContext(context.Background(), cfg)
+}
+
+// LoadPolicyWithContext reads the policy, giving up when ctx is done
+func LoadPolicyWithContext(ctx context.Context, cfg Config) (*Policy, error) {
+	data, err := GetObjectWithContext(ctx, cfg, PolicyFile)
+	if err != nil {
+		if IsNotFound(err) {
+			return DefaultPolicy(), nil
+		}
+		return nil, fmt.Errorf("error fetching %s: %v", PolicyFile, err)
+	}
+	return ParsePolicy(data)
+}
+
+// ParsePolicy parses a policy file, filling unset defaults from DefaultPolicy
+func ParsePolicy(data []byte) (*Policy, error) {
+	var policy Policy
+	if err := yaml.Unmarshal(data, &policy); err != nil {
+		return nil, fmt.Errorf("error parsing %s: %v", PolicyFile, err)
+	}
+
+	policy.Defaults = mergeRule(DefaultPolicy().Defaults, policy.Defaults)
+	if policy.Defaults.Name == "" {
+		policy.Defaults.Name = "default"
+	}
+
+	for _, rule := range append([]PolicyRule{policy.Defaults}, policy.Rules...) {
+		for _, w := range rule.Windows {
+			if _, _, err := w.bounds(); err != nil {
+				return nil, fmt.Errorf("rule %q: %v", rule.Name, err)
+			}
+		}
+	}
+
+	for i := range policy.Webhooks {
+		webhook := &policy.Webhooks[i]
+		if webhook.Name == "" {
+			webhook.Name = fmt.Sprintf("webhook-%d", i+1)
+		}
+		if err := webhook.validate(); err != nil {
+			return nil, err
+		}
+	}
+	return &policy, nil
+}
+
+// mergeRule overlays the fields set in override onto base
+func mergeRule(base, override PolicyRule) PolicyRule {
+	merged := base
+	merged.Name = override.Name
+	merged.Configs = override.Configs
+	merged.Tags = override.Tags
+	if override.MinDuration != 0 {
+		merged.MinDuration = override.MinDuration
+	}
+	if override.MaxDuration != 0 {
+		merged.MaxDuration = override.MaxDuration
+	}
+	if override.DefaultDuration != 0 {
+		merged.DefaultDuration = override.DefaultDuration
+	}
+	if override.Roles != nil {
+		merged.Roles = override.Roles
+	}
+	if override.Namespaces != nil {
+		merged.Namespaces = override.Namespaces
+	}
+	if override.Users != nil {
+		merged.Users = override.Users
+	}
+	if override.Groups != nil {
+		merged.Groups = override.Groups
+	}
+	if override.RequireReason {
+		merged.RequireReason = true
+	}
+	if override.RequireApproval {
+		merged.RequireApproval = true
+	}
+	if override.Windows != nil {
+		merged.Windows = override.Windows
+	}
+	return merged
+}
+
+// RuleFor returns the effective rule for a kubeconfig: the first matching
+// rule merged over the defaults
+func (p *Policy) RuleFor(configName string, tags map[string]string) PolicyRule {
+	for _, rule := range p.Rules {
+		if rule.matches(configName, tags) {
+			return mergeRule(p.Defaults, rule)
+		}
+	}
+	return p.Defaults
+}
+
+func (r PolicyRule) matches(configName string, tags map[string]string) bool {
+	if len(r.Configs) == 0 && len(r.Tags) == 0 {
+		return false
+	}
+	if len(r.Configs) > 0 && !matchAny(r.Configs, configName) {
+		return false
+	}
+	for key, value := range r.Tags {
+		if tags[key] != value {
+			return false
+		}
+	}
+	return true
+}
+
+func matchAny(patterns []string, value string) bool {
+	for _, pattern := range patterns {
+		if ok, _ := path.Match(pattern, value); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// RoleNames returns every role the policy can grant, sorted
+func (p *Policy) RoleNames() []string {
+	seen := map[string]bool{DefaultRole: true}
+	for _, role := range p.Defaults.Roles {
+		seen[role] = true
+	}
+	for _, rule := range p.Rules {
+		for _, role := range rule.Roles {
+			seen[role] = true
+		}
+	}
+
+	names := make([]string, 0, len(seen))
+	for role := range seen {
+		names = append(names, role)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// GroupsOf returns the policy groups a user belongs to
+func (p *Policy) GroupsOf(user string) []string {
+	var groups []string
+	for group, members := range p.Groups {
+		if contains(members, user) {
+			groups = append(groups, group)
+		}
+	}
+	return groups
+}
+
+// Evaluate decides whether an access request is allowed and explains why not
+func (p *Policy) Evaluate(req AccessRequest) *Decision {
+	rule := p.RuleFor(req.Config, req.Tags)
+	decision := &Decision{
+		Rule:            rule.Name,
+		Role:            req.Role,
+		Roles:           rule.Roles,
+		Namespaces:      rule.Namespaces,
+		Duration:        req.Duration,
+		MaxDuration:     time.Duration(rule.MaxDuration),
+		RequireReason:   rule.RequireReason,
+		RequireApproval: rule.RequireApproval,
+	}
+	deny := func(format string, args ...interface{}) {
+		decision.Denials = append(decision.Denials, fmt.Sprintf(format, args...))
+	}
+
+	// Duration
+	if decision.Duration == 0 {
+		decision.Duration = time.Duration(rule.DefaultDuration)
+		if max := time.Duration(rule.MaxDuration); max > 0 && decision.Duration > max {
+			decision.Duration = max
+		}
+	}
+	if min := time.Duration(rule.MinDuration); decision.Duration < min {
+		decision.Notes = append(decision.Notes, fmt.Sprintf("duration raised to the minimum of %s", min))
+		decision.Duration = min
+	}
+	if max := time.Duration(rule.MaxDuration); max > 0 && decision.Duration > max {
+		deny("duration %s exceeds the maximum of %s", decision.Duration, max)
+	}
+
+	// Role
+	if decision.Role == "" {
+		decision.Role = DefaultRole
+		if len(rule.Roles) > 0 {
+			decision.Role = rule.Roles[0]
+		}
+	}
+	if len(rule.Roles) > 0 && !contains(rule.Roles, decision.Role) {
+		deny("role %s is not allowed (allowed: %s)", decision.Role, strings.Join(rule.Roles, ", "))
+	}
+
+	// Namespace
+	if len(rule.Namespaces) > 0 {
+		if req.Namespace == "" {
+			deny("cluster-wide access is not allowed (allowed namespaces: %s)", strings.Join(rule.Namespaces, ", "))
+		} else if !matchAny(rule.Namespaces, req.Namespace) {
+			deny("namespace %s is not allowed (allowed: %s)", req.Namespace, strings.Join(rule.Namespaces, ", "))
+		}
+	}
+
+	// Users and groups
+	if len(rule.Users) > 0 || len(rule.Groups) > 0 {
+		groups := append(p.GroupsOf(req.User), req.Groups...)
+		allowed := contains(rule.Users, req.User)
+		for _, group := range groups {
+			if contains(rule.Groups, group) {
+				allowed = true
+			}
+		}
+		if !allowed {
+			deny("user %s is not in the allowed users or groups", req.User)
+		}
+	}
+
+	// Reason
+	if rule.RequireReason && strings.TrimSpace(req.Reason) == "" {
+		deny("a reason is required")
+	}
+
+	// Time windows
+	if len(rule.Windows) > 0 {
+		at := req.Time
+		if at.IsZero() {
+			at = time.Now()
+		}
+		inWindow := false
+		var windows []string
+		for _, w := range rule.Windows {
+			if w.contains(at) {
+				inWindow = true
+			}
+			windows = append(windows, w.String())
+		}
+		if !inWindow {
+			deny("activation is only allowed during %s", strings.Join(windows, "; "))
+		}
+	}
+
+	decision.Allowed = len(decision.Denials) == 0
+	return decision
+}
+
+func (w TimeWindow) bounds() (time.Duration, time.Duration, error) {
+	start, err := parseClock(w.Start)
+	if err != nil {
+		return 0, 0, err
+	}
+	end, err := parseClock(w.End)
+	if err != nil {
+		return 0, 0, err
+	}
+	if w.Timezone != "" {
+		if _, err := time.LoadLocation(w.Timezone); err != nil {
+			return 0, 0, fmt.Errorf("invalid timezone %q", w.Timezone)
+		}
+	}
+	return start, end, nil
+}
+
+func parseClock(s string) (time.Duration, error) {
+	t, err := time.Parse("15:04", s)
+	if err != nil {
+		return 0, fmt.Errorf("invalid time %q (use HH:MM)", s)
+	}
+	return time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute, nil
+}
+
+func (w TimeWindow) contains(at time.Time) bool {
+	start, end, err := w.bounds()
+	if err != nil {
+		return false
+	}
+	if w.Timezone != "" {
+		loc, _ := time.LoadLocation(w.Timezone)
+		at = at.In(loc)
+	}
+
+	day := strings.ToLower(at.Weekday().String()[:3])
+	clock := time.Duration(at.Hour())*time.Hour + time.Duration(at.Minute())*time.Minute
+
+	// Windows spanning midnight belong to the day they start on
+	if end <= start && clock < end {
+		day = strings.ToLower(at.AddDate(0, 0, -1).Weekday().String()[:3])
+	}
+	if len(w.Days) > 0 && !containsFold(w.Days, day) {
+		return false
+	}
+
+	if end > start {
+		return clock >= start && clock < end
+	}
+	return clock >= start || clock < end
+}
+
+func (w TimeWindow) String() string {
+	s := fmt.Sprintf("%s-%s", w.Start, w.End)
+	if len(w.Days) > 0 {
+		s = strings.Join(w.Days, ",") + " " + s
+	}
+	if w.Timezone != "" {
+		s += " " + w.Timezone
+	}
+	return s
+}
+
+func containsFold(list []string, value string) bool {
+	for _, item := range list {
+		if len(item) >= 3 && strings.EqualFold(item[:3], value) {
+			return true
+		}
+	}
+	return false
+}
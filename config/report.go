@@ -0,0 +1,137 @@
+package config
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"time"
+)
+
+// Usage report groupings
+const (
+	GroupByUser    = "user"
+	GroupByCluster = "cluster"
+	GroupByRole    = "role"
+)
+
+// UsageRow aggregates the sessions of one user, cluster or role
+type UsageRow struct {
+	Key                string        `json:"key"`
+	Sessions           int           `json:"sessions"`
+	SessionTime        time.Duration `json:"-"`
+	SessionHours       float64       `json:"session_hours"`
+	EarlyDeactivations int           `json:"early_deactivations"`
+	Denials            int           `json:"denials"`
+}
+
+// usageKey returns the group of an event
+func usageKey(e *AuditEvent, groupBy string) string {
+	switch groupBy {
+	case GroupByCluster:
+		switch {
+		case e.Cluster != "":
+			return e.Cluster
+		case e.Server != "":
+			return e.Server
+		}
+		return e.Config
+	case GroupByRole:
+		switch {
+		case e.Role == "" && e.AuthMode == "":
+			return "(unspecified)"
+		case e.Role == "":
+			return "(" + e.AuthMode + ")"
+		}
+		if e.RoleNamespace != "" {
+			return e.Role + " (" + e.RoleNamespace + ")"
+		}
+		return e.Role
+	}
+	return e.User
+}
+
+// UsageReport aggregates activation records into session counts, total
+// session time, early deactivations and policy denials. A session lasts
+// until its expiry, an earlier deactivation or, while it runs, now.
+// Sessions cannot be extended; a longer session is a new activation.
+func UsageReport(events []*AuditEvent, groupBy string) ([]*UsageRow, error) {
+	switch groupBy {
+	case GroupByUser, GroupByCluster, GroupByRole:
+	default:
+		return nil, fmt.Errorf("unknown grouping %q (use %s, %s or %s)", groupBy, GroupByUser, GroupByCluster, GroupByRole)
+	}
+
+	// Find when each session ended
+	ended := make(map[string]time.Time)
+	for _, e := range events {
+		if e.SessionID == "" || e.Result != ResultSuccess || e.Event != AuditDeactivate {
+			continue
+		}
+		if _, ok := ended[e.SessionID]; !ok {
+			ended[e.SessionID] = e.Time
+		}
+	}
+	now := time.Now()
+
+	rows := make(map[string]*UsageRow)
+	activations := make(map[string]*AuditEvent)
+	row := func(e *AuditEvent) *UsageRow {
+		key := usageKey(e, groupBy)
+		if rows[key] == nil {
+			rows[key] = &UsageRow{Key: key}
+		}
+		return rows[key]
+	}
+
+	// Group activations (AuditActivateGroup) are not counted; each member
+	// records its own activation
+	for _, e := range events {
+		switch e.Event {
+		case AuditActivate:
+			if e.Result == ResultDenied {
+				row(e).Denials++
+				continue
+			}
+			if e.Result != ResultSuccess {
+				continue
+			}
+			activations[e.SessionID] = e
+
+			r := row(e)
+			r.Sessions++
+			end := e.ExpiresAt
+			if now.Before(end) {
+				end = now
+			}
+			if deactivated, ok := ended[e.SessionID]; ok && deactivated.Before(end) {
+				end = deactivated
+			}
+			if end.After(e.Time) {
+				r.SessionTime += end.Sub(e.Time)
+			}
+
+		case AuditDeactivate:
+			activation := activations[e.SessionID]
+			if activation == nil || e.Result != ResultSuccess {
+				continue
+			}
+			if e.Time.Before(e.ExpiresAt) {
+				row(activation).EarlyDeactivations++
+			}
+		}
+	}
+
+	var report []*UsageRow
+	for _, r := range rows {
+		r.SessionTime = r.SessionTime.Round(time.Minute)
+		r.SessionHours = math.Round(r.SessionTime.Hours()*100) / 100
+		report = append(report, r)
+	}
+	sort.Slice(report, func(i, j int) bool {
+		if report[i].SessionTime != report[j].SessionTime {
+			return report[i].SessionTime > report[j].SessionTime
+		}
+		return report[i].Key < report[j].Key
+	})
+	return report, nil
+}
@@ -2,17 +2,15 @@ package config
 
 import (
 	"bytes"
-	"encoding/json"
 	"fmt"
 	"os"
 	"os/exec"
+	"strconv"
 	"strings"
 	"sync"
 	"text/template"
 	"time"
 
-	"encoding/base64"
-
 	"gopkg.in/yaml.v3"
 )
 
@@ -24,6 +22,39 @@ type ServiceAccountConfig struct {
 	User        string
 	ExpiresAt   time.Time
 	CreatedAt   string
+	// Role is the ClusterRole granted to the service account, cluster-wide or
+	// only within RoleNamespace when set
+	Role          string
+	RoleNamespace string
+	SessionID     string
+	Reason        string
+	Ticket        string
+	// Audiences are added to the API server audience of session tokens
+	Audiences []string
+}
+
+// AccessOptions describes the access granted by CreateTemporaryAccess
+type AccessOptions struct {
+	SessionID string
+	Duration  time.Duration
+	Role      string
+	Namespace string
+	Reason    string
+	Ticket    string
+	Audiences []string
+}
+
+// TokenOptions scopes a token minted by IssueToken
+type TokenOptions struct {
+	Audiences       []string
+	BoundObjectKind string
+	BoundObjectName string
+	ExpiresAt       time.Time
+}
+
+// BindingName returns the name of the role binding for the service account
+func (c *ServiceAccountConfig) BindingName() string {
+	return c.Name + "-binding"
 }
 
 const serviceAccountTemplate = `
@@ -35,27 +66,42 @@ metadata:
   labels:
     kubconfig.io/managed-by: "kubconfig-cli"
     kubconfig.io/user: "{{ .User }}"
+    kubconfig.io/session: "{{ .SessionID }}"
   annotations:
     kubconfig.io/created-by: "{{ .User }}"
     kubconfig.io/created-at: "{{ .CreatedAt }}"
+    kubconfig.io/reason: {{ quote .Reason }}
+    kubconfig.io/ticket: {{ quote .Ticket }}
 ---
 apiVersion: rbac.authorization.k8s.io/v1
+{{- if .RoleNamespace }}
+kind: RoleBinding
+metadata:
+  name: {{ .BindingName }}
+  namespace: {{ .RoleNamespace }}
+{{- else }}
 kind: ClusterRoleBinding
 metadata:
-  name: {{ .Name }}-admin
+  name: {{ .BindingName }}
+{{- end }}
   labels:
     kubconfig.io/managed-by: "kubconfig-cli"
     kubconfig.io/user: "{{ .User }}"
+    kubconfig.io/service-account: "{{ .Name }}"
+    kubconfig.io/session: "{{ .SessionID }}"
   annotations:
     kubconfig.io/created-by: "{{ .User }}"
     kubconfig.io/created-at: "{{ .CreatedAt }}"
+    kubconfig.io/role: "{{ .Role }}"
+    kubconfig.io/reason: {{ quote .Reason }}
+    kubconfig.io/ticket: {{ quote .Ticket }}
 subjects:
 - kind: ServiceAccount
   name: {{ .Name }}
   namespace: {{ .Namespace }}
 roleRef:
   kind: ClusterRole
-  name: cluster-admin
+  name: {{ .Role }}
   apiGroup: rbac.authorization.k8s.io
 `
 
@@ -65,26 +111,36 @@ var (
 	activeSessions      = make(map[string]*ServiceAccountConfig)
 )
 
-func verifyClusterAccess() error {
-	cmd := exec.Command("kubectl", "auth", "can-i", "create", "serviceaccount")
-	var stderr bytes.Buffer
-	cmd.Stderr = &stderr
-	if err := cmd.Run(); err != nil {
-		return fmt.Errorf("no cluster access: %v\nkubectl output: %s", err, stderr.String())
+func verifyClusterAccess(opts AccessOptions) error {
+	checks := [][]string{
+		{"auth", "can-i", "create", "serviceaccount", "-n", "kube-system"},
+		{"auth", "can-i", "create", "clusterrolebinding"},
+	}
+	if opts.Namespace != "" {
+		checks[1] = []string{"auth", "can-i", "create", "rolebinding", "-n", opts.Namespace}
+	}
+
+	for _, check := range checks {
+		cmd := exec.Command("kubectl", check...)
+		var stderr bytes.Buffer
+		cmd.Stderr = &stderr
+		if err := cmd.Run(); err != nil {
+			return fmt.Errorf("no cluster access (%s): %v\nkubectl output: %s", strings.Join(check[2:], " "), err, stderr.String())
+		}
 	}
 	return nil
 }
 
-func CreateTemporaryAccess(duration time.Duration) (*ServiceAccountConfig, error) {
+func CreateTemporaryAccess(opts AccessOptions) (*ServiceAccountConfig, error) {
 	fmt.Println("Creating temporary access...")
 
 	// First verify cluster access
-	if err := verifyClusterAccess(); err != nil {
+	if err := verifyClusterAccess(opts); err != nil {
 		return nil, fmt.Errorf("cluster access check failed: %v", err)
 	}
 
 	// Get current user
-	user, err := getCurrentUser()
+	user, err := CurrentUser()
 	if err != nil {
 		return nil, err
 	}
@@ -95,27 +151,38 @@ func CreateTemporaryAccess(duration time.Duration) (*ServiceAccountConfig, error
 		return nil, err
 	}
 
+	// Every session gets its own ServiceAccount, so concurrent sessions of
+	// a user neither replace each other's role nor revoke each other
 	config := &ServiceAccountConfig{
-		Name:        fmt.Sprintf("%s-user", user),
-		Namespace:   "kube-system",
-		ServerURL:   serverURL,
-		ClusterName: clusterName,
-		User:        user,
-		ExpiresAt:   time.Now().Add(duration),
-		CreatedAt:   time.Now().Format(time.RFC3339),
-	}
-
-	// Check if SA already exists
-	if !serviceAccountExists(config) {
-		// Create service account and related resources
-		if err := createResources(config); err != nil {
-			return nil, err
-		}
+		Name:          serviceAccountName(user, opts.SessionID),
+		Namespace:     "kube-system",
+		ServerURL:     serverURL,
+		ClusterName:   clusterName,
+		User:          user,
+		ExpiresAt:     time.Now().Add(opts.Duration),
+		CreatedAt:     time.Now().Format(time.RFC3339),
+		Role:          opts.Role,
+		RoleNamespace: opts.Namespace,
+		SessionID:     opts.SessionID,
+		Reason:        opts.Reason,
+		Ticket:        opts.Ticket,
+		Audiences:     opts.Audiences,
+	}
+	if config.Role == "" {
+		config.Role = DefaultRole
+	}
+
+	// Create service account and related resources, removing whatever was
+	// created when this fails
+	if err := createResources(config); err != nil {
+		CleanupTemporaryAccess(config)
+		return nil, err
+	}
 
-		// Wait for SA to be ready
-		if err := waitForServiceAccount(config); err != nil {
-			return nil, fmt.Errorf("service account not ready: %v", err)
-		}
+	// Wait for SA to be ready
+	if err := waitForServiceAccount(config); err != nil {
+		CleanupTemporaryAccess(config)
+		return nil, fmt.Errorf("service account not ready: %v", err)
 	}
 
 	fmt.Println("Temporary access created successfully.")
@@ -141,18 +208,10 @@ func waitForServiceAccount(config *ServiceAccountConfig) error {
 	return fmt.Errorf("timeout waiting for service account to be ready")
 }
 
-func serviceAccountExists(config *ServiceAccountConfig) bool {
-	cmd := exec.Command("kubectl", "get", "serviceaccount",
-		config.Name,
-		"-n", config.Namespace,
-		"--ignore-not-found",
-		"-o", "jsonpath={.metadata.name}")
-	output, _ := cmd.Output()
-	return len(output) > 0
-}
-
 func createResources(config *ServiceAccountConfig) error {
-	tmpl, err := template.New("sa").Parse(serviceAccountTemplate)
+	tmpl, err := template.New("sa").Funcs(template.FuncMap{
+		"quote": strconv.Quote,
+	}).Parse(serviceAccountTemplate)
 	if err != nil {
 		return err
 	}
@@ -178,37 +237,25 @@ func createResources(config *ServiceAccountConfig) error {
 	return nil
 }
 
+// CleanupTemporaryAccess deletes the ServiceAccount and role bindings of a
+// session. Resources are selected by session label, so the ServiceAccount
+// a user shared between sessions in earlier versions survives until its
+// latest session ends.
 func CleanupTemporaryAccess(config *ServiceAccountConfig) error {
-	// Check if there are any other active sessions for this user
-	activeSessionsMutex.RLock()
-	hasActiveSessions := false
-	for _, session := range activeSessions {
-		if session.User == config.User && !time.Now().After(session.ExpiresAt) {
-			hasActiveSessions = true
-			break
-		}
-	}
-	activeSessionsMutex.RUnlock()
-
-	// Don't clean up if there are other active sessions
-	if hasActiveSessions {
-		return nil
-	}
-
 	var errs []string
 
 	// Delete in reverse order
-	cmd := exec.Command("kubectl", "delete", "clusterrolebinding",
-		fmt.Sprintf("%s-admin", config.Name),
-		"--ignore-not-found=true")
-	if err := cmd.Run(); err != nil {
-		errs = append(errs, fmt.Sprintf("failed to delete clusterrolebinding: %v", err))
+	if err := removeBindings(config); err != nil {
+		errs = append(errs, err.Error())
 	}
 
-	cmd = exec.Command("kubectl", "delete", "serviceaccount",
-		"-n", config.Namespace,
-		config.Name,
-		"--ignore-not-found=true")
+	args := []string{"delete", "serviceaccount", "-n", config.Namespace, "--ignore-not-found=true"}
+	if config.SessionID != "" {
+		args = append(args, "-l", "kubconfig.io/session="+config.SessionID)
+	} else {
+		args = append(args, config.Name)
+	}
+	cmd := exec.Command("kubectl", args...)
 	if err := cmd.Run(); err != nil {
 		errs = append(errs, fmt.Sprintf("failed to delete serviceaccount: %v", err))
 	}
@@ -219,7 +266,35 @@ func CleanupTemporaryAccess(config *ServiceAccountConfig) error {
 	return nil
 }
 
-func getCurrentUser() (string, error) {
+// removeBindings deletes the role bindings of a session or, for
+// kubeconfigs found without a session, of its service account
+func removeBindings(config *ServiceAccountConfig) error {
+	selector := "kubconfig.io/session=" + config.SessionID
+	if config.SessionID == "" {
+		selector = "kubconfig.io/service-account=" + config.Name
+	}
+	commands := [][]string{
+		{"delete", "clusterrolebinding", "-l", selector, "--ignore-not-found=true"},
+		{"delete", "rolebinding", "--all-namespaces", "-l", selector, "--ignore-not-found=true"},
+	}
+	if config.SessionID == "" {
+		// Bindings created before roles were configurable carry no label
+		commands = append(commands, []string{"delete", "clusterrolebinding", config.Name + "-admin", "--ignore-not-found=true"})
+	}
+
+	for _, args := range commands {
+		cmd := exec.Command("kubectl", args...)
+		var stderr bytes.Buffer
+		cmd.Stderr = &stderr
+		if err := cmd.Run(); err != nil {
+			return fmt.Errorf("failed to delete %s: %v\nkubectl output: %s", args[1], err, stderr.String())
+		}
+	}
+	return nil
+}
+
+// CurrentUser returns the local user name
+func CurrentUser() (string, error) {
 	cmd := exec.Command("whoami")
 	out, err := cmd.Output()
 	if err != nil {
@@ -237,32 +312,29 @@ func getClusterInfo() (string, string, error) {
 		return "", "", fmt.Errorf("cannot access cluster: %v\nkubectl output: %s", err, stderr.String())
 	}
 
-	cmd = exec.Command("kubectl", "config", "view", "--minify", "-o", "jsonpath={.clusters[0].name}")
-	clusterName, err := cmd.Output()
+	// Resolve the cluster through the current context
+	cmd = exec.Command("kubectl", "config", "view", "--minify")
+	kubeconfig, err := cmd.Output()
 	if err != nil {
-		return "", "", fmt.Errorf("error getting cluster name: %v", err)
+		return "", "", fmt.Errorf("error reading kubeconfig: %v", err)
 	}
-
-	cmd = exec.Command("kubectl", "config", "view", "--minify", "-o", "jsonpath={.clusters[0].cluster.server}")
-	serverURL, err := cmd.Output()
+	clusterName, serverURL, err := KubeconfigCluster(kubeconfig)
 	if err != nil {
-		return "", "", fmt.Errorf("error getting server URL: %v", err)
+		return "", "", err
 	}
 
-	if len(clusterName) == 0 || len(serverURL) == 0 {
-		return "", "", fmt.Errorf("invalid cluster info: name=%q, url=%q", string(clusterName), string(serverURL))
+	if clusterName == "" || serverURL == "" {
+		return "", "", fmt.Errorf("invalid cluster info: name=%q, url=%q", clusterName, serverURL)
 	}
 
-	return string(bytes.TrimSpace(clusterName)), string(bytes.TrimSpace(serverURL)), nil
+	return clusterName, serverURL, nil
 }
 
 func GetTokenAndCert(config *ServiceAccountConfig) (string, string, error) {
 	// First get the CA cert from the cluster
-	cmd := exec.Command("kubectl", "config", "view", "--raw", "-o",
-		"jsonpath={.clusters[0].cluster.certificate-authority-data}")
-	caBytes, err := cmd.Output()
+	caCert, err := ClusterCA()
 	if err != nil {
-		return "", "", fmt.Errorf("error getting CA cert: %v", err)
+		return "", "", err
 	}
 
 	// Calculate duration and ensure it's in seconds
@@ -293,30 +365,29 @@ func GetTokenAndCert(config *ServiceAccountConfig) (string, string, error) {
 	fmt.Printf("Created token for service account: %s (expires in %s)\n",
 		config.Name, duration.Round(time.Second))
 
-	return token, string(caBytes), nil
+	return token, caCert, nil
 }
 
-// Add function to verify token expiry
-func verifyTokenExpiry(token string, expectedExpiry time.Time) error {
-	parts := strings.Split(token, ".")
-	if len(parts) != 3 {
-		return fmt.Errorf("invalid token format")
-	}
-
-	// Decode the payload (second part)
-	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+// ClusterCA returns the base64 encoded CA certificate of the current
+// cluster, reading it from disk when the kubeconfig only references a file
+func ClusterCA() (string, error) {
+	cmd := exec.Command("kubectl", "config", "view", "--raw", "--minify", "--flatten", "-o",
+		"jsonpath={.clusters[0].cluster.certificate-authority-data}")
+	caBytes, err := cmd.Output()
 	if err != nil {
-		return fmt.Errorf("error decoding token: %v", err)
+		return "", fmt.Errorf("error getting CA cert: %v", err)
 	}
+	return string(bytes.TrimSpace(caBytes)), nil
+}
 
-	var claims struct {
-		Exp int64 `json:"exp"`
-	}
-	if err := json.Unmarshal(payload, &claims); err != nil {
-		return fmt.Errorf("error parsing token claims: %v", err)
+// Add function to verify token expiry
+func verifyTokenExpiry(token string, expectedExpiry time.Time) error {
+	claims, err := DecodeTokenClaims(token)
+	if err != nil {
+		return err
 	}
 
-	tokenExpiry := time.Unix(claims.Exp, 0)
+	tokenExpiry := claims.ExpiresAt()
 	fmt.Printf("Token will expire at: %s\n", tokenExpiry.Format(time.RFC3339))
 
 	// Allow small time difference (1 minute) due to processing time
@@ -329,6 +400,8 @@ func verifyTokenExpiry(token string, expectedExpiry time.Time) error {
 	return nil
 }
 
+// GetServiceAccountFromConfig returns the ServiceAccount a session kubeconfig
+// authenticates as, read from the claims of its token
 func GetServiceAccountFromConfig(configPath string) (*ServiceAccountConfig, error) {
 	data, err := os.ReadFile(configPath)
 	if err != nil {
@@ -340,17 +413,28 @@ func GetServiceAccountFromConfig(configPath string) (*ServiceAccountConfig, erro
 		return nil, err
 	}
 
-	// Extract service account name from context
-	contexts, ok := kubeconfig["contexts"].([]interface{})
-	if !ok || len(contexts) == 0 {
-		return nil, fmt.Errorf("no contexts found")
+	contextName, _, _, err := contextEntries(kubeconfig, "")
+	if err != nil {
+		return nil, err
+	}
+	_, userData, err := sessionUser(kubeconfig)
+	if err != nil {
+		return nil, err
+	}
+
+	if token, ok := userData["token"].(string); ok && token != "" {
+		if claims, err := DecodeTokenClaims(token); err == nil && claims.Kubernetes != nil {
+			return &ServiceAccountConfig{
+				Name:      claims.Kubernetes.ServiceAccount.Name,
+				Namespace: claims.Kubernetes.Namespace,
+			}, nil
+		}
 	}
 
-	context := contexts[0].(map[interface{}]interface{})
-	contextName := context["name"].(string)
+	// Older session kubeconfigs named their context <serviceaccount>@<cluster>
 	parts := strings.Split(contextName, "@")
 	if len(parts) != 2 {
-		return nil, fmt.Errorf("invalid context name format")
+		return nil, fmt.Errorf("no ServiceAccount token found in kubeconfig")
 	}
 
 	return &ServiceAccountConfig{
@@ -359,7 +443,13 @@ func GetServiceAccountFromConfig(configPath string) (*ServiceAccountConfig, erro
 	}, nil
 }
 
+// GenerateKubeconfig returns a self-contained kubeconfig authenticating as
+// the service account, defaulting to the namespace its role is bound in
 func GenerateKubeconfig(config *ServiceAccountConfig, token, caCert string) string {
+	namespace := config.RoleNamespace
+	if namespace == "" {
+		namespace = "default"
+	}
 	return fmt.Sprintf(`apiVersion: v1
 kind: Config
 clusters:
@@ -371,7 +461,7 @@ contexts:
 - name: %s@%s
   context:
     cluster: %s
-    namespace: default
+    namespace: %s
     user: %s
 current-context: %s@%s
 users:
@@ -380,7 +470,7 @@ users:
     token: %s
 `, config.ClusterName, caCert, config.ServerURL,
 		config.Name, config.ClusterName,
-		config.ClusterName, config.Name,
+		config.ClusterName, namespace, config.Name,
 		config.Name, config.ClusterName,
 		config.Name, token)
 }
@@ -474,6 +564,21 @@ func GetTemporaryToken(config *ServiceAccountConfig) (string, error) {
 		return "", fmt.Errorf("token verification failed: %v", err)
 	}
 
+	// Extra audiences replace the default, so keep the API server's
+	if len(config.Audiences) > 0 {
+		claims, err := DecodeTokenClaims(token)
+		if err != nil {
+			return "", err
+		}
+		token, err = IssueToken(config, TokenOptions{
+			Audiences: append(claims.Audience, config.Audiences...),
+			ExpiresAt: config.ExpiresAt,
+		})
+		if err != nil {
+			return "", err
+		}
+	}
+
 	// Format expiry time nicely
 	duration := time.Duration(durationSeconds) * time.Second
 	var expiryMsg string
@@ -500,6 +605,52 @@ func GetTemporaryToken(config *ServiceAccountConfig) (string, error) {
 	return token, nil
 }
 
+// IssueToken mints a token for the service account limited to the given
+// audiences and, optionally, bound to a Pod or Secret so it dies with it
+func IssueToken(config *ServiceAccountConfig, opts TokenOptions) (string, error) {
+	duration := time.Until(opts.ExpiresAt).Round(time.Second)
+	if duration < 10*time.Minute {
+		return "", fmt.Errorf("tokens must be valid for at least 10 minutes, %s left", duration)
+	}
+
+	args := []string{"create", "token", config.Name,
+		"--namespace", config.Namespace,
+		"--duration", fmt.Sprintf("%ds", int(duration.Seconds()))}
+	for _, audience := range opts.Audiences {
+		args = append(args, "--audience", audience)
+	}
+	if opts.BoundObjectKind != "" || opts.BoundObjectName != "" {
+		switch opts.BoundObjectKind {
+		case "Pod", "Secret":
+		default:
+			return "", fmt.Errorf("tokens can only be bound to a Pod or Secret, not %q", opts.BoundObjectKind)
+		}
+		if opts.BoundObjectName == "" {
+			return "", fmt.Errorf("the name of the bound %s is required", opts.BoundObjectKind)
+		}
+		args = append(args, "--bound-object-kind", opts.BoundObjectKind, "--bound-object-name", opts.BoundObjectName)
+	}
+
+	tokenCmd := exec.Command("kubectl", args...)
+	var stderr bytes.Buffer
+	tokenCmd.Stderr = &stderr
+	tokenBytes, err := tokenCmd.Output()
+	if err != nil {
+		return "", fmt.Errorf("error creating token: %v\nOutput: %s", err, stderr.String())
+	}
+
+	token := string(bytes.TrimSpace(tokenBytes))
+	claims, err := DecodeTokenClaims(token)
+	if err != nil {
+		return "", fmt.Errorf("token verification failed: %v", err)
+	}
+	if claims.ExpiresAt().After(opts.ExpiresAt.Add(time.Minute)) {
+		return "", fmt.Errorf("token verification failed: expires at %s, after %s",
+			claims.ExpiresAt().Format(time.RFC3339), opts.ExpiresAt.Format(time.RFC3339))
+	}
+	return token, nil
+}
+
 // Helper function to add plural 's'
 func pluralize(n int) string {
 	if n == 1 {
@@ -531,17 +682,14 @@ func ModifyKubeconfigWithToken(originalConfig []byte, token string) ([]byte, err
 		return nil, fmt.Errorf("error parsing kubeconfig: %v", err)
 	}
 
-	// Modify the users section to use the new token
-	users, ok := kubeconfig["users"].([]interface{})
-	if !ok || len(users) == 0 {
-		return nil, fmt.Errorf("no users found in kubeconfig")
+	// The token must be the user's only credential: API servers try client
+	// certificates first, and exec plugins or auth providers would hand out
+	// the master identity
+	_, _, user, err := contextEntries(kubeconfig, "")
+	if err != nil {
+		return nil, err
 	}
-
-	user := users[0].(map[string]interface{})
-	userData := user["user"].(map[string]interface{})
-
-	// Replace only the token, keeping other auth methods if present
-	userData["token"] = token
+	user["user"] = map[string]interface{}{"token": token}
 
 	return yaml.Marshal(kubeconfig)
 }
@@ -0,0 +1,297 @@
+package config
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// AuthGroup marks sessions bundling sessions on several clusters in one
+// kubeconfig
+const AuthGroup = "group"
+
+// SessionEnv selects a session other than the current one, e.g. in shells
+// started for a single session
+const SessionEnv = "KUBCONFIG_SESSION"
+
+// Session records an activated kubeconfig so it can be inspected and revoked.
+// Issued sessions live in a standalone kubeconfig instead of the default one,
+// which may have been shared with or received from another user. Group
+// sessions hold one member session per cluster of a merged kubeconfig.
+type Session struct {
+	ID             string     `json:"id"`
+	Config         string     `json:"config"`
+	Cluster        string     `json:"cluster,omitempty"`
+	Server         string     `json:"server,omitempty"`
+	User           string     `json:"user"`
+	AuthMode       string     `json:"auth_mode"`
+	ServiceAccount string     `json:"service_account,omitempty"`
+	Namespace      string     `json:"namespace,omitempty"`
+	Role           string     `json:"role,omitempty"`
+	RoleNamespace  string     `json:"role_namespace,omitempty"`
+	Context        string     `json:"context,omitempty"`
+	Reason         string     `json:"reason,omitempty"`
+	Ticket         string     `json:"ticket,omitempty"`
+	Kubeconfig     string     `json:"kubeconfig"`
+	Issued         bool       `json:"issued,omitempty"`
+	SharedWith     string     `json:"shared_with,omitempty"`
+	SharedBy       string     `json:"shared_by,omitempty"`
+	CreatedAt      time.Time  `json:"created_at"`
+	ExpiresAt      time.Time  `json:"expires_at"`
+	Members        []*Session `json:"members,omitempty"`
+}
+
+type SessionRegistry struct {
+	Current  string     `json:"current,omitempty"`
+	Sessions []*Session `json:"sessions"`
+}
+
+var (
+	ticketPattern      = regexp.MustCompile(`\b[A-Z][A-Z0-9]+-[0-9]+\b`)
+	invalidNamePattern = regexp.MustCompile(`[^a-z0-9-]+`)
+)
+
+// NewSessionID returns a random session identifier
+func NewSessionID() string {
+	return randString(8)
+}
+
+// ExtractTicket returns the first ticket reference (e.g. INC-1234) in a reason
+func ExtractTicket(reason string) string {
+	return ticketPattern.FindString(reason)
+}
+
+// serviceAccountName returns a valid, per-session ServiceAccount name
+func serviceAccountName(user, sessionID string) string {
+	name := invalidNamePattern.ReplaceAllString(strings.ToLower(user), "-")
+	name = strings.Trim(name, "-")
+	if len(name) > 40 {
+		name = name[:40]
+	}
+	if name == "" {
+		name = "user"
+	}
+	return fmt.Sprintf("%s-%s", name, sessionID)
+}
+
+// Expired reports whether the session has expired
+func (s *Session) Expired() bool {
+	return time.Now().After(s.ExpiresAt)
+}
+
+// Switchable reports whether the session can be made current with 'use',
+// unlike sessions private to a shell or command and issued kubeconfigs
+func (s *Session) Switchable() bool {
+	return s.Kubeconfig == GetSessionFile(s.ID)
+}
+
+// Remaining returns the time left in the session
+func (s *Session) Remaining() time.Duration {
+	if s.Expired() {
+		return 0
+	}
+	return time.Until(s.ExpiresAt)
+}
+
+// LoadSessionRegistry reads the local session registry
+func LoadSessionRegistry() (*SessionRegistry, error) {
+	registry := &SessionRegistry{}
+	data, err := os.ReadFile(SessionRegistryFile)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return registry, nil
+		}
+		return nil, err
+	}
+
+	if err := json.Unmarshal(data, registry); err != nil {
+		return nil, fmt.Errorf("error parsing session registry: %v", err)
+	}
+	return registry, nil
+}
+
+// Save writes the registry, replacing the previous file atomically
+func (r *SessionRegistry) Save() error {
+	if err := os.MkdirAll(filepath.Dir(SessionRegistryFile), 0700); err != nil {
+		return err
+	}
+
+	data, err := json.MarshalIndent(r, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	tmp := SessionRegistryFile + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, SessionRegistryFile)
+}
+
+// UpdateSessionRegistry applies update to the registry on disk while holding
+// its lock, so concurrent activations do not drop each other's sessions
+func UpdateSessionRegistry(update func(*SessionRegistry)) error {
+	if err := os.MkdirAll(filepath.Dir(SessionRegistryFile), 0700); err != nil {
+		return err
+	}
+	unlock, err := lockFile(SessionRegistryFile)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	registry, err := LoadSessionRegistry()
+	if err != nil {
+		return err
+	}
+	update(registry)
+	return registry.Save()
+}
+
+// Add records a session, replacing any session with the same ID
+func (r *SessionRegistry) Add(session *Session) {
+	r.Remove(session.ID)
+	r.Sessions = append(r.Sessions, session)
+}
+
+// Get returns the session with the given ID or nil
+func (r *SessionRegistry) Get(id string) *Session {
+	for _, session := range r.Sessions {
+		if session.ID == id {
+			return session
+		}
+	}
+	return nil
+}
+
+// Remove deletes a session from the registry
+func (r *SessionRegistry) Remove(id string) {
+	sessions := r.Sessions[:0]
+	for _, session := range r.Sessions {
+		if session.ID != id {
+			sessions = append(sessions, session)
+		}
+	}
+	r.Sessions = sessions
+	if r.Current == id {
+		r.Current = ""
+	}
+}
+
+// CurrentSession returns the session active in the default kubeconfig or nil
+func (r *SessionRegistry) CurrentSession() *Session {
+	if r.Current == "" {
+		return nil
+	}
+	return r.Get(r.Current)
+}
+
+// RevokeSession removes the credentials and cluster objects of a session
+// using the master kubeconfig it was created from
+func RevokeSession(session *Session) error {
+	// Received sessions can only be revoked by whoever shared them
+	if session.SharedBy != "" {
+		return nil
+	}
+
+	if session.AuthMode == AuthGroup {
+		var failed []string
+		for _, member := range session.Members {
+			if err := RevokeSession(member); err != nil {
+				failed = append(failed, fmt.Sprintf("%s: %v", member.Config, err))
+			}
+		}
+		if len(failed) > 0 {
+			return fmt.Errorf("error revoking %s", strings.Join(failed, "; "))
+		}
+		return nil
+	}
+
+	switch session.AuthMode {
+	case AuthImpersonate:
+		return RevokeImpersonation(session.ID)
+	case AuthServiceAccount:
+		return WithMasterKubeconfig(session.Config, session.Context, func() error {
+			return CleanupTemporaryAccess(session.ServiceAccountConfig())
+		})
+	}
+
+	// EKS and exec sessions expire on their own and hold nothing to remove
+	return nil
+}
+
+// ServiceAccountConfig returns the ServiceAccount of a session
+func (s *Session) ServiceAccountConfig() *ServiceAccountConfig {
+	return &ServiceAccountConfig{
+		Name:          s.ServiceAccount,
+		Namespace:     s.Namespace,
+		User:          s.User,
+		ExpiresAt:     s.ExpiresAt,
+		Role:          s.Role,
+		RoleNamespace: s.RoleNamespace,
+		SessionID:     s.ID,
+	}
+}
+
+// WithMasterKubeconfig runs fn with KUBECONFIG pointing at the master
+// kubeconfig of a bucket config, reduced to the session's context when one
+// is given, so kubectl acts with its credentials
+func WithMasterKubeconfig(configName, contextName string, fn func() error) error {
+	master, err := MasterKubeconfig(configName, contextName)
+	if err != nil {
+		return err
+	}
+
+	originalKubeconfig := os.Getenv("KUBECONFIG")
+	os.Setenv("KUBECONFIG", master)
+	defer os.Setenv("KUBECONFIG", originalKubeconfig)
+
+	return fn()
+}
+
+// MasterKubeconfig returns the path of the cached master kubeconfig,
+// downloading it again if the cache has been cleaned up. With a context,
+// the path of a copy holding only that context is returned.
+func MasterKubeconfig(configName, contextName string) (string, error) {
+	path := filepath.Join(CacheDir, configName)
+	if !IsCached(configName) {
+		cfg, err := LoadConfig()
+		if err != nil {
+			return "", err
+		}
+		data, err := GetObject(cfg, configName)
+		if err != nil {
+			return "", fmt.Errorf("error fetching %s: %v", configName, err)
+		}
+		if err := os.MkdirAll(CacheDir, 0700); err != nil {
+			return "", err
+		}
+		if err := os.WriteFile(path, data, 0600); err != nil {
+			return "", err
+		}
+	}
+	if contextName == "" {
+		return path, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	minified, _, err := MinifyKubeconfig(data, contextName)
+	if err != nil {
+		return "", err
+	}
+
+	// Context names may contain characters that are invalid in file names
+	contextPath := fmt.Sprintf("%s.%x.context", path, sha256.Sum256([]byte(contextName)))
+	if err := os.WriteFile(contextPath, minified, 0600); err != nil {
+		return "", err
+	}
+	return contextPath, nil
+}
@@ -0,0 +1,187 @@
+package config
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdh"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+const shareVersion = 1
+
+// SharedKubeconfig is a session kubeconfig handed to another user
+type SharedKubeconfig struct {
+	SessionID  string    `json:"session_id"`
+	Config     string    `json:"config"`
+	Cluster    string    `json:"cluster,omitempty"`
+	Server     string    `json:"server,omitempty"`
+	Role       string    `json:"role,omitempty"`
+	Namespace  string    `json:"namespace,omitempty"`
+	SharedBy   string    `json:"shared_by"`
+	SharedWith string    `json:"shared_with"`
+	ExpiresAt  time.Time `json:"expires_at"`
+	Kubeconfig []byte    `json:"kubeconfig"`
+}
+
+// shareEnvelope is the object uploaded under shares/. Only the holder of
+// the recipient's X25519 key can derive the AES key from the ephemeral key.
+type shareEnvelope struct {
+	Version      int       `json:"version"`
+	Recipient    string    `json:"recipient"`
+	ExpiresAt    time.Time `json:"expires_at"`
+	EphemeralKey string    `json:"ephemeral_key"`
+	Nonce        string    `json:"nonce"`
+	Ciphertext   string    `json:"ciphertext"`
+}
+
+// additionalData binds the unencrypted fields of an envelope to its ciphertext
+func (e *shareEnvelope) additionalData() []byte {
+	return []byte(fmt.Sprintf("%d\n%s\n%s", e.Version, e.Recipient, e.ExpiresAt.UTC().Format(time.RFC3339Nano)))
+}
+
+// ShareObject returns the bucket key of a session's shared kubeconfig
+func ShareObject(sessionID string) string {
+	return fmt.Sprintf("shares/%s.json", sessionID)
+}
+
+// shareKey derives the AES-256 key of an envelope from the X25519 secret
+func shareKey(secret []byte, ephemeral, recipient *ecdh.PublicKey) []byte {
+	h := sha256.New()
+	h.Write([]byte("kubconfig-share-v1"))
+	h.Write(secret)
+	h.Write(ephemeral.Bytes())
+	h.Write(recipient.Bytes())
+	return h.Sum(nil)
+}
+
+// SealShare encrypts a shared kubeconfig to the recipient's public key
+func SealShare(recipient *PublicIdentity, share *SharedKubeconfig) ([]byte, error) {
+	recipientKey, err := recipient.encryptionKey()
+	if err != nil {
+		return nil, err
+	}
+	ephemeral, err := ecdh.X25519().GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	secret, err := ephemeral.ECDH(recipientKey)
+	if err != nil {
+		return nil, err
+	}
+
+	plaintext, err := json.Marshal(share)
+	if err != nil {
+		return nil, err
+	}
+	gcm, err := newShareCipher(shareKey(secret, ephemeral.PublicKey(), recipientKey))
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+
+	envelope := shareEnvelope{
+		Version:      shareVersion,
+		Recipient:    recipient.Name,
+		ExpiresAt:    share.ExpiresAt.UTC(),
+		EphemeralKey: base64.StdEncoding.EncodeToString(ephemeral.PublicKey().Bytes()),
+		Nonce:        base64.StdEncoding.EncodeToString(nonce),
+	}
+	envelope.Ciphertext = base64.StdEncoding.EncodeToString(gcm.Seal(nil, nonce, plaintext, envelope.additionalData()))
+	return json.MarshalIndent(envelope, "", "  ")
+}
+
+// OpenShare decrypts a shared kubeconfig with the local identity
+func OpenShare(identity *Identity, data []byte) (*SharedKubeconfig, error) {
+	var envelope shareEnvelope
+	if err := json.Unmarshal(data, &envelope); err != nil {
+		return nil, fmt.Errorf("not a shared kubeconfig: %v", err)
+	}
+	if envelope.Version != shareVersion {
+		return nil, fmt.Errorf("unsupported share version %d", envelope.Version)
+	}
+	if time.Now().After(envelope.ExpiresAt) {
+		return nil, fmt.Errorf("shared kubeconfig expired at %s", envelope.ExpiresAt.Local().Format(time.RFC3339))
+	}
+
+	key, err := identity.decryptionKey()
+	if err != nil {
+		return nil, err
+	}
+	ephemeralBytes, err := base64.StdEncoding.DecodeString(envelope.EphemeralKey)
+	if err != nil {
+		return nil, fmt.Errorf("invalid ephemeral key")
+	}
+	ephemeral, err := ecdh.X25519().NewPublicKey(ephemeralBytes)
+	if err != nil {
+		return nil, fmt.Errorf("invalid ephemeral key")
+	}
+	nonce, err := base64.StdEncoding.DecodeString(envelope.Nonce)
+	if err != nil {
+		return nil, fmt.Errorf("invalid nonce")
+	}
+	ciphertext, err := base64.StdEncoding.DecodeString(envelope.Ciphertext)
+	if err != nil {
+		return nil, fmt.Errorf("invalid ciphertext")
+	}
+
+	secret, err := key.ECDH(ephemeral)
+	if err != nil {
+		return nil, err
+	}
+	gcm, err := newShareCipher(shareKey(secret, ephemeral, key.PublicKey()))
+	if err != nil {
+		return nil, err
+	}
+	if len(nonce) != gcm.NonceSize() {
+		return nil, fmt.Errorf("invalid nonce")
+	}
+	plaintext, err := gcm.Open(nil, nonce, ciphertext, envelope.additionalData())
+	if err != nil {
+		return nil, fmt.Errorf("cannot decrypt with the key of %s: shared with %s or modified in transit", identity.Name, envelope.Recipient)
+	}
+
+	var share SharedKubeconfig
+	if err := json.Unmarshal(plaintext, &share); err != nil {
+		return nil, fmt.Errorf("error parsing shared kubeconfig: %v", err)
+	}
+	return &share, nil
+}
+
+func newShareCipher(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// FetchShare downloads a shared kubeconfig from a presigned URL or reads it
+// from a local file
+func FetchShare(location string) ([]byte, error) {
+	if !strings.HasPrefix(location, "https://") && !strings.HasPrefix(location, "http://") {
+		return os.ReadFile(location)
+	}
+
+	client := &http.Client{Timeout: 30 * time.Second}
+	resp, err := client.Get(location)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("download failed: %s (the link may have expired)", resp.Status)
+	}
+	return io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+}
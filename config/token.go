@@ -146,45 +146,18 @@ func randString(n int) string {
 	return string(b)
 }
 
-// VerifyTokenExpiry checks if the token has expired
+// VerifyTokenExpiry checks if the session credential of a kubeconfig has expired
 func VerifyTokenExpiry(kubeconfigPath string) (bool, time.Time, error) {
 	data, err := os.ReadFile(kubeconfigPath)
 	if err != nil {
 		return false, time.Time{}, err
 	}
 
-	var kubeconfig yaml.MapSlice
-	if err := yaml.Unmarshal(data, &kubeconfig); err != nil {
+	credential, err := ReadSessionCredential(data)
+	if err != nil {
 		return false, time.Time{}, err
 	}
-
-	for _, item := range kubeconfig {
-		if item.Key == "users" {
-			if users, ok := item.Value.([]interface{}); ok {
-				for _, user := range users {
-					if userMap, ok := user.(map[interface{}]interface{}); ok {
-						if auth, ok := userMap["user"].(map[interface{}]interface{}); ok {
-							// Check for exec configuration
-							if execConfig, ok := auth["exec"].(map[interface{}]interface{}); ok {
-								if args, ok := execConfig["args"].([]interface{}); ok {
-									for i, arg := range args {
-										if arg == "--expiry" && i+1 < len(args) {
-											if expiryStr, ok := args[i+1].(string); ok {
-												expiry, err := time.Parse(time.RFC3339, expiryStr)
-												if err != nil {
-													return false, time.Time{}, err
-												}
-												return time.Now().After(expiry), expiry, nil
-											}
-										}
-									}
-								}
-							}
-						}
-					}
-				}
-			}
-		}
-	}
-	return false, time.Time{}, fmt.Errorf("no token expiry found")
+	// Tokens without an exp claim do not expire
+	expired := !credential.ExpiresAt.IsZero() && time.Now().After(credential.ExpiresAt)
+	return expired, credential.ExpiresAt, nil
 }
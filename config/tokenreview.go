@@ -0,0 +1,54 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os/exec"
+)
+
+// TokenReviewStatus is the API server's verdict on a token
+type TokenReviewStatus struct {
+	Authenticated bool     `json:"authenticated"`
+	Audiences     []string `json:"audiences,omitempty"`
+	Error         string   `json:"error,omitempty"`
+	User          struct {
+		Username string   `json:"username,omitempty"`
+		UID      string   `json:"uid,omitempty"`
+		Groups   []string `json:"groups,omitempty"`
+	} `json:"user"`
+}
+
+// ReviewToken submits a TokenReview through the given kubeconfig to check
+// whether the API server still accepts a token
+func ReviewToken(kubeconfigPath, token string, audiences []string) (*TokenReviewStatus, error) {
+	review := map[string]interface{}{
+		"apiVersion": "authentication.k8s.io/v1",
+		"kind":       "TokenReview",
+		"spec": map[string]interface{}{
+			"token":     token,
+			"audiences": audiences,
+		},
+	}
+	data, err := json.Marshal(review)
+	if err != nil {
+		return nil, err
+	}
+
+	cmd := exec.Command("kubectl", "--kubeconfig", kubeconfigPath, "create", "-f", "-", "-o", "json")
+	cmd.Stdin = bytes.NewReader(data)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	output, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("error creating TokenReview: %v\nOutput: %s", err, stderr.String())
+	}
+
+	var result struct {
+		Status TokenReviewStatus `json:"status"`
+	}
+	if err := json.Unmarshal(output, &result); err != nil {
+		return nil, fmt.Errorf("error parsing TokenReview: %v", err)
+	}
+	return &result.Status, nil
+}
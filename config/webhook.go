@@ -0,0 +1,279 @@
+package config
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+)
+
+// Webhook payload formats
+const (
+	WebhookSlack   = "slack"
+	WebhookGeneric = "generic"
+)
+
+const (
+	// NotifyTag marks kubeconfigs whose sessions are announced to webhooks
+	NotifyTag = "notify"
+
+	// webhookTimeout bounds one notification, from reading the tags and
+	// policy to all deliveries and their retries. Group members share it.
+	webhookTimeout = 5 * time.Second
+)
+
+// Webhook is an HTTP endpoint configured under webhooks: in the policy
+type Webhook struct {
+	Name     string            `yaml:"name,omitempty"`
+	URL      string            `yaml:"url"`
+	Format   string            `yaml:"format,omitempty"`
+	Template string            `yaml:"template,omitempty"`
+	Headers  map[string]string `yaml:"headers,omitempty"`
+	Events   []string          `yaml:"events,omitempty"`
+}
+
+// Notification is the data sent to webhooks and available to templates
+type Notification struct {
+	Event     string    `json:"event"`
+	Time      time.Time `json:"time"`
+	User      string    `json:"user"`
+	SessionID string    `json:"session_id"`
+	Config    string    `json:"config"`
+	Cluster   string    `json:"cluster,omitempty"`
+	Server    string    `json:"server,omitempty"`
+	Role      string    `json:"role,omitempty"`
+	Namespace string    `json:"namespace,omitempty"`
+	Duration  string    `json:"duration,omitempty"`
+	ExpiresAt time.Time `json:"expires_at"`
+	Reason    string    `json:"reason,omitempty"`
+	Ticket    string    `json:"ticket,omitempty"`
+}
+
+// validate checks the format and template of a webhook
+func (w *Webhook) validate() error {
+	if w.URL == "" {
+		return fmt.Errorf("webhook %q has no url", w.Name)
+	}
+	switch w.Format {
+	case "", WebhookGeneric, WebhookSlack:
+	default:
+		return fmt.Errorf("webhook %q: unknown format %q (use %s or %s)", w.Name, w.Format, WebhookSlack, WebhookGeneric)
+	}
+	if w.Template != "" {
+		if _, err := template.New(w.Name).Parse(w.Template); err != nil {
+			return fmt.Errorf("webhook %q: invalid template: %v", w.Name, err)
+		}
+	}
+	return nil
+}
+
+// payload renders the request body of a notification
+func (w *Webhook) payload(n *Notification) ([]byte, error) {
+	if w.Template != "" {
+		tmpl, err := template.New(w.Name).Parse(w.Template)
+		if err != nil {
+			return nil, err
+		}
+		var buf bytes.Buffer
+		if err := tmpl.Execute(&buf, n); err != nil {
+			return nil, err
+		}
+		return buf.Bytes(), nil
+	}
+
+	if w.Format == WebhookSlack {
+		return json.Marshal(map[string]string{"text": slackText(n)})
+	}
+	return json.Marshal(n)
+}
+
+func slackText(n *Notification) string {
+	var text string
+	switch n.Event {
+	case AuditActivate:
+		text = fmt.Sprintf(":unlock: *%s* activated *%s*", n.User, n.Config)
+	case AuditDeactivate:
+		text = fmt.Sprintf(":lock: *%s* deactivated *%s*", n.User, n.Config)
+	default:
+		text = fmt.Sprintf("*%s*: %s on *%s*", n.User, n.Event, n.Config)
+	}
+
+	var details []string
+	if n.Cluster != "" {
+		details = append(details, "cluster `"+n.Cluster+"`")
+	}
+	if n.Role != "" {
+		role := "role `" + n.Role + "`"
+		if n.Namespace != "" {
+			role += " in `" + n.Namespace + "`"
+		}
+		details = append(details, role)
+	}
+	if n.Event != AuditDeactivate && n.Duration != "" {
+		details = append(details, "for "+n.Duration)
+	}
+	if len(details) > 0 {
+		text += " (" + strings.Join(details, ", ") + ")"
+	}
+	if n.Reason != "" {
+		text += "\n>" + n.Reason
+	}
+	return text
+}
+
+// wants reports whether the webhook subscribes to an event
+func (w *Webhook) wants(event string) bool {
+	return len(w.Events) == 0 || contains(w.Events, event)
+}
+
+// webhookStatusError is a delivery the endpoint answered with an error status
+type webhookStatusError struct {
+	name   string
+	status string
+	code   int
+}
+
+func (e *webhookStatusError) Error() string {
+	return fmt.Sprintf("webhook %q returned %s", e.name, e.status)
+}
+
+// deliver posts a payload, retrying network errors and 5xx responses with
+// exponential backoff until the context expires
+func (w *Webhook) deliver(ctx context.Context, body []byte) error {
+	backoff := 250 * time.Millisecond
+	for {
+		err := w.post(ctx, body)
+		if err == nil {
+			return nil
+		}
+		var statusErr *webhookStatusError
+		if errors.As(err, &statusErr) && statusErr.code < 500 {
+			return err
+		}
+
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+	}
+}
+
+func (w *Webhook) post(ctx context.Context, body []byte) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, w.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for name, value := range w.Headers {
+		req.Header.Set(name, value)
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return &webhookStatusError{name: w.Name, status: resp.Status, code: resp.StatusCode}
+	}
+	return nil
+}
+
+// NotifySession sends a session event to the policy's webhooks when the
+// session's kubeconfig is tagged notify=true. Deliveries run in parallel and
+// give up after a few seconds, also for all members of a group together.
+func NotifySession(cfg Config, event string, session *Session) error {
+	ctx, cancel := context.WithTimeout(context.Background(), webhookTimeout)
+	defer cancel()
+	return notifySession(ctx, cfg, event, session)
+}
+
+func notifySession(ctx context.Context, cfg Config, event string, session *Session) error {
+	if session.AuthMode == AuthGroup {
+		errs := make([]error, len(session.Members))
+		var wg sync.WaitGroup
+		for i, member := range session.Members {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				errs[i] = notifySession(ctx, cfg, event, member)
+			}()
+		}
+		wg.Wait()
+		for _, err := range errs {
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	tags, err := GetObjectTagsWithContext(ctx, cfg, session.Config)
+	if err != nil {
+		return fmt.Errorf("error reading tags of %s: %v", session.Config, err)
+	}
+	if !strings.EqualFold(tags[NotifyTag], "true") {
+		return nil
+	}
+
+	policy, err := LoadPolicyWithContext(ctx, cfg)
+	if err != nil {
+		return err
+	}
+
+	n := &Notification{
+		Event:     event,
+		Time:      time.Now().UTC(),
+		User:      session.User,
+		SessionID: session.ID,
+		Config:    session.Config,
+		Cluster:   session.Cluster,
+		Server:    session.Server,
+		Role:      session.Role,
+		Namespace: session.RoleNamespace,
+		ExpiresAt: session.ExpiresAt,
+		Reason:    session.Reason,
+		Ticket:    session.Ticket,
+	}
+	if !session.CreatedAt.IsZero() {
+		n.Duration = session.ExpiresAt.Sub(session.CreatedAt).Round(time.Minute).String()
+	}
+
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	var failures []string
+	for i := range policy.Webhooks {
+		webhook := &policy.Webhooks[i]
+		if !webhook.wants(event) {
+			continue
+		}
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			body, err := webhook.payload(n)
+			if err == nil {
+				err = webhook.deliver(ctx, body)
+			}
+			if err != nil {
+				mu.Lock()
+				failures = append(failures, fmt.Sprintf("%s: %v", webhook.Name, err))
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+
+	if len(failures) > 0 {
+		return fmt.Errorf("webhook delivery failed: %s", strings.Join(failures, "; "))
+	}
+	return nil
+}
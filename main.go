@@ -21,7 +21,31 @@ func main() {
 	rootCmd.AddCommand(cmd.AnalyzeCmd)
 	rootCmd.AddCommand(cmd.StatusCmd)
 	rootCmd.AddCommand(cmd.DeactivateCmd)
+	rootCmd.AddCommand(cmd.UseCmd)
+	rootCmd.AddCommand(cmd.LsActiveCmd)
 	rootCmd.AddCommand(cmd.VerifyCmd)
+	rootCmd.AddCommand(cmd.TokenCmd)
+	rootCmd.AddCommand(cmd.PolicyCmd)
+	rootCmd.AddCommand(cmd.ApproveCmd)
+	rootCmd.AddCommand(cmd.DenyCmd)
+	rootCmd.AddCommand(cmd.RequestsCmd)
+	rootCmd.AddCommand(cmd.AuditCmd)
+	rootCmd.AddCommand(cmd.ReportCmd)
+	rootCmd.AddCommand(cmd.SessionReportCmd)
+	rootCmd.AddCommand(cmd.PromptCmd)
+	rootCmd.AddCommand(cmd.IssueCmd)
+	rootCmd.AddCommand(cmd.RevokeCmd)
+	rootCmd.AddCommand(cmd.ShareCmd)
+	rootCmd.AddCommand(cmd.ReceiveCmd)
+	rootCmd.AddCommand(cmd.KeysCmd)
+	rootCmd.AddCommand(cmd.ExecCmd)
+	rootCmd.AddCommand(cmd.ShellCmd)
+	rootCmd.AddCommand(cmd.ShellInitCmd)
+	rootCmd.AddCommand(cmd.RecentCmd)
+	rootCmd.AddCommand(cmd.AliasCmd)
+	rootCmd.AddCommand(cmd.CatalogRefreshCmd)
+	rootCmd.AddCommand(cmd.ActivateMemberCmd)
+	rootCmd.AddCommand(cmd.ImpersonationProxyCmd)
 
 	// Add shell completion
 	rootCmd.CompletionOptions.DisableDefaultCmd = false